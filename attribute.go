@@ -0,0 +1,204 @@
+package sqlcomposer
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"strings"
+)
+
+type AttributeStorage string
+
+const (
+	// Comma separated tags, such as red,blue
+	StorageCSV AttributeStorage = "csv"
+	// JSON array, such as ["red","blue"]
+	StorageJSON = "json"
+	// PostgreSQL array
+	StorageArray = "array"
+)
+
+// Declaration of the attribute, the storage of multi-value columns decide how has_any, has_all and has_none render,
+// and string values of filters are coerced to the type
+//
+//	attributes:
+//	  products.tags:
+//	    storage: json
+//	  users.age:
+//	    type: int
+type AttributeDefinition struct {
+	Storage AttributeStorage `yaml:"storage,omitempty"`
+	Type    string           `yaml:"type,omitempty"`
+}
+
+func (a AttributeDefinition) validate(attr string) error {
+	if !validType(a.Type) {
+		return fmt.Errorf("attribute %s type %s is not supported", attr, a.Type)
+	}
+
+	switch a.Storage {
+	case "", StorageCSV, StorageJSON, StorageArray:
+		return nil
+	}
+
+	return fmt.Errorf("attribute %s storage %s is not supported", attr, a.Storage)
+}
+
+// Storage of the attr, comma separated tags by default
+func (cb ConditionBuilder) storage(attr string) AttributeStorage {
+	if a, ok := cb.Attributes[attr]; ok && a.Storage != "" {
+		return a.Storage
+	}
+
+	return StorageCSV
+}
+
+// Render the tag operators by the storage of attr and dialect
+func (cb ConditionBuilder) tags(f Filter, name string, params map[string]interface{}) (string, error) {
+	var tags []interface{}
+
+	rv := reflect.ValueOf(f.Val)
+	if rv.Kind() == reflect.Slice {
+		for i := 0; i < rv.Len(); i++ {
+			tags = append(tags, rv.Index(i).Interface())
+		}
+	} else if f.Val != nil {
+		tags = append(tags, f.Val)
+	}
+
+	if len(tags) == 0 {
+		return "", errors.New("tags value must be non empty")
+	}
+
+	var (
+		clause string
+		err    error
+	)
+
+	switch cb.storage(f.Attr) {
+	case StorageJSON:
+		clause, err = cb.jsonTags(f, tags, name, params)
+	case StorageArray:
+		clause, err = cb.arrayTags(f, tags, name, params)
+	default:
+		clause = cb.csvTags(f, tags, name, params)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	// the column of NULL has none of the tags, rather than makes the NOT unknown
+	if f.Op == HasNone {
+		return fmt.Sprintf("(%s IS NULL OR NOT (%s))", f.Attr, clause), nil
+	}
+
+	return clause, nil
+}
+
+// Escape the wildcards of LIKE pattern, it is used with ESCAPE '!' which is the same in all dialects
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// Tags of all operator must be contained, any of others
+func tagsJoin(op Operator, clauses []string) string {
+	if len(clauses) == 1 {
+		return clauses[0]
+	}
+
+	if op == HasAll {
+		return fmt.Sprintf("(%s)", strings.Join(clauses, " AND "))
+	}
+
+	return fmt.Sprintf("(%s)", strings.Join(clauses, " OR "))
+}
+
+func (cb ConditionBuilder) csvTags(f Filter, tags []interface{}, name string, params map[string]interface{}) string {
+	var clauses []string
+
+	for i, tag := range tags {
+		key := fmt.Sprintf("%s_%d", name, i)
+
+		switch cb.Dialect {
+		case PostgreSQL, SQLite:
+			params[key] = fmt.Sprintf("%%,%s,%%", likeEscaper.Replace(fmt.Sprint(tag)))
+			clauses = append(clauses, fmt.Sprintf("(',' || %s || ',') LIKE :%s ESCAPE '!'", f.Attr, key))
+		default:
+			params[key] = tag
+			clauses = append(clauses, fmt.Sprintf("FIND_IN_SET(:%s, %s)", key, f.Attr))
+		}
+	}
+
+	return tagsJoin(f.Op, clauses)
+}
+
+func (cb ConditionBuilder) jsonTags(f Filter, tags []interface{}, name string, params map[string]interface{}) (string, error) {
+	switch cb.Dialect {
+	case PostgreSQL:
+		var clauses []string
+
+		for i, tag := range tags {
+			b, err := json.Marshal([]interface{}{tag})
+
+			if err != nil {
+				return "", err
+			}
+
+			key := fmt.Sprintf("%s_%d", name, i)
+			params[key] = string(b)
+			clauses = append(clauses, fmt.Sprintf("%s @> CAST(:%s AS jsonb)", f.Attr, key))
+		}
+
+		return tagsJoin(f.Op, clauses), nil
+	case SQLite:
+		params[name] = tags
+
+		if f.Op == HasAll {
+			distinct := map[string]bool{}
+			for _, tag := range tags {
+				distinct[fmt.Sprint(tag)] = true
+			}
+
+			key := name + "_count"
+			params[key] = len(distinct)
+
+			return fmt.Sprintf("(SELECT COUNT(DISTINCT json_each.value) FROM json_each(%s) WHERE json_each.value IN (:%s)) = :%s",
+				f.Attr, name, key), nil
+		}
+
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(%s) WHERE json_each.value IN (:%s))", f.Attr, name), nil
+	}
+
+	b, err := json.Marshal(tags)
+
+	if err != nil {
+		return "", err
+	}
+
+	params[name] = string(b)
+
+	if f.Op == HasAll {
+		return fmt.Sprintf("JSON_CONTAINS(%s, :%s)", f.Attr, name), nil
+	}
+
+	return fmt.Sprintf("JSON_OVERLAPS(%s, :%s)", f.Attr, name), nil
+}
+
+func (cb ConditionBuilder) arrayTags(f Filter, tags []interface{}, name string, params map[string]interface{}) (string, error) {
+	if cb.Dialect != PostgreSQL {
+		return "", fmt.Errorf("array storage of %s is not supported by dialect %s", f.Attr, cb.Dialect)
+	}
+
+	var keys []string
+	for i, tag := range tags {
+		key := fmt.Sprintf("%s_%d", name, i)
+		params[key] = tag
+		keys = append(keys, ":"+key)
+	}
+
+	if f.Op == HasAll {
+		return fmt.Sprintf("%s @> ARRAY[%s]", f.Attr, strings.Join(keys, ", ")), nil
+	}
+
+	return fmt.Sprintf("%s && ARRAY[%s]", f.Attr, strings.Join(keys, ", ")), nil
+}
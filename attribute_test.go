@@ -0,0 +1,158 @@
+package sqlcomposer
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestConditionBuilder_Tags(t *testing.T) {
+	attributes := map[string]AttributeDefinition{
+		"products.labels": {Storage: StorageJSON},
+		"products.codes":  {Storage: StorageArray},
+	}
+
+	f := &[]Filter{
+		{Val: []string{"red", "blue"}, Op: HasAny, Attr: "products.tags"},
+		{Val: []string{"red", "blue"}, Op: HasAll, Attr: "products.labels"},
+		{Val: "old", Op: HasNone, Attr: "products.labels"},
+	}
+
+	s, err := ConditionBuilder{Dialect: MySQL, Attributes: attributes}.WhereAnd(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "(FIND_IN_SET(:products_tags_0, products.tags) OR FIND_IN_SET(:products_tags_1, products.tags)) AND "+
+		"JSON_CONTAINS(products.labels, :products_labels) AND "+
+		"(products.labels IS NULL OR NOT (JSON_OVERLAPS(products.labels, :products_labels_1)))", s.Clause)
+	assert.Equal(t, map[string]interface{}{
+		"products_tags_0":   "red",
+		"products_tags_1":   "blue",
+		"products_labels":   `["red","blue"]`,
+		"products_labels_1": `["old"]`,
+	}, s.Arg)
+
+	f = &[]Filter{
+		{Val: []string{"red", "blue"}, Op: HasAny, Attr: "products.labels"},
+		{Val: []int{1, 2}, Op: HasAll, Attr: "products.codes"},
+	}
+
+	s, err = ConditionBuilder{Dialect: PostgreSQL, Attributes: attributes}.WhereAnd(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "(products.labels @> CAST(:products_labels_0 AS jsonb) OR products.labels @> CAST(:products_labels_1 AS jsonb)) AND "+
+		"products.codes @> ARRAY[:products_codes_0, :products_codes_1]", s.Clause)
+	assert.Equal(t, `["blue"]`, s.Arg["products_labels_1"])
+
+	_, err = ConditionBuilder{Dialect: SQLite, Attributes: attributes}.WhereAnd(&[]Filter{
+		{Val: []int{1}, Op: HasAny, Attr: "products.codes"},
+	})
+	assert.Error(t, err)
+
+	_, err = Conditions(&[]Filter{{Val: []string{}, Op: HasAny, Attr: "products.tags"}}, AND)
+	assert.Error(t, err)
+
+	// the plain filter after tags of the same attr must not take the clause of tags
+	s, err = Conditions(&[]Filter{
+		{Val: []string{"a", "b"}, Op: HasAny, Attr: "p.tags"},
+		{Val: "x", Op: Equal, Attr: "p.tags"},
+	}, AND)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "(FIND_IN_SET(:p_tags_0, p.tags) OR FIND_IN_SET(:p_tags_1, p.tags)) AND p.tags = :p_tags_2", s.Clause)
+	assert.Equal(t, map[string]string{
+		"p_tags":   "(FIND_IN_SET(:p_tags_0, p.tags) OR FIND_IN_SET(:p_tags_1, p.tags))",
+		"p_tags_2": "p.tags = :p_tags_2",
+	}, s.ClauseSlice)
+}
+
+func TestSqlBuilder_Tags(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  attributes:
+    products.labels:
+      storage: json
+  fields:
+    base:
+      - name: id
+        expr: products.id
+  subject:
+    list: "SELECT %fields.base FROM products %where ORDER BY products.id"`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		db.MustExec("CREATE TABLE products (id integer, tags text, labels text)")
+		defer db.MustExec("DROP TABLE products")
+
+		db.MustExec(`INSERT INTO products (id, tags, labels) VALUES (1, 'red,blue', '["red","blue"]'), ` +
+			`(2, 'blue', '["blue"]'), (3, 'green,old', '["green","old"]'), (4, NULL, NULL), (5, 'axb', '["axb"]')`)
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cases := []struct {
+			filter Filter
+			ids    []int
+		}{
+			{Filter{Val: []string{"red", "green"}, Op: HasAny, Attr: "products.tags"}, []int{1, 3}},
+			{Filter{Val: []string{"red", "blue"}, Op: HasAll, Attr: "products.tags"}, []int{1}},
+			{Filter{Val: []string{"blue"}, Op: HasNone, Attr: "products.tags"}, []int{3, 4, 5}},
+			// the wildcards of like are escaped
+			{Filter{Val: "a_b", Op: HasAny, Attr: "products.tags"}, nil},
+			{Filter{Val: []string{"red", "green"}, Op: HasAny, Attr: "products.labels"}, []int{1, 3}},
+			{Filter{Val: []string{"blue", "red", "blue"}, Op: HasAll, Attr: "products.labels"}, []int{1}},
+			{Filter{Val: "old", Op: HasNone, Attr: "products.labels"}, []int{1, 2, 4, 5}},
+		}
+
+		// json functions need the sqlite_json build tag of go-sqlite3
+		if _, err := db.Exec("SELECT json('[]')"); err != nil {
+			cases = cases[:4]
+		}
+
+		for _, c := range cases {
+			sb.Reset()
+
+			if err = sb.AddFilters([]Filter{c.filter}, AND); err != nil {
+				t.Fatal(err)
+			}
+
+			q, a, err := sb.Rebind("list")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []int
+			if err = db.Select(&ids, q, a...); err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, c.ids, ids, c.filter)
+		}
+	})
+
+	_, err := NewSqlBuilder(nil, []byte(`
+info:
+  name: example
+  version: 1.0.0
+composition:
+  attributes:
+    products.tags:
+      storage: set
+  subject:
+    list: "SELECT * FROM products %where"`))
+	assert.Error(t, err)
+}
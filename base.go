@@ -1,7 +1,9 @@
 package sqlcomposer
 
 import (
+	"context"
 	"fmt"
+	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"reflect"
 	"regexp"
@@ -30,6 +32,20 @@ const (
 	NotBetween              = "not_between"
 	IsNull                  = "is_null"
 	IsNotNull               = "is_not_null"
+	// Attr is the comma separated columns, such as shop_id,sku, and value is the list of tuples
+	TupleIn = "tuple_in"
+	// Attr is the multi-value column stored as declared by the attributes of doc, value is the list of tags
+	HasAny  = "has_any"
+	HasAll  = "has_all"
+	HasNone = "has_none"
+	// Value is the regular expression pattern
+	Matches    = "matches"
+	NotMatches = "not_matches"
+	// Value is the regular expression pattern matched case insensitively
+	IMatches    = "imatches"
+	NotIMatches = "not_imatches"
+	// Equality treat NULL as value, such as <=> of MySQL
+	NullSafeEqual = "<=>"
 )
 
 const (
@@ -51,6 +67,9 @@ type Filter struct {
 	Val  interface{}
 	Op   Operator
 	Attr string
+	// Scope name the where/having token the filter render to, such as inner for %where.inner,
+	// empty scope render to %where and %having
+	Scope string
 }
 
 type FilterGroup struct {
@@ -62,8 +81,28 @@ type FilterGroup struct {
 // Condition handlers
 //
 
-// Handle filters to filters statement
+// ConditionBuilder handle filters to statement in the syntax of dialect, Attributes declare the storage of
+// multi-value columns
+type ConditionBuilder struct {
+	Dialect    Dialect
+	Attributes map[string]AttributeDefinition
+}
+
+// Handle filters to filters statement in the syntax of MySQL
 func Conditions(f *[]Filter, op LogicOperator) (stmt ConditionStmt, err error) {
+	return ConditionBuilder{Dialect: MySQL}.Conditions(f, op)
+}
+
+func (cb ConditionBuilder) WhereOr(f *[]Filter) (stmt ConditionStmt, err error) {
+	return cb.Conditions(f, OR)
+}
+
+func (cb ConditionBuilder) WhereAnd(f *[]Filter) (stmt ConditionStmt, err error) {
+	return cb.Conditions(f, AND)
+}
+
+// Handle filters to filters statement
+func (cb ConditionBuilder) Conditions(f *[]Filter, op LogicOperator) (stmt ConditionStmt, err error) {
 	var (
 		conditions []string
 	)
@@ -75,8 +114,46 @@ func Conditions(f *[]Filter, op LogicOperator) (stmt ConditionStmt, err error) {
 	for _, value := range *f {
 		var str strings.Builder
 
+		value.Val, err = cb.coerce(value)
+		if err != nil {
+			return stmt, err
+		}
+
 		paramsAttr := strings.Replace(value.Attr, ".", "_", -1)
-		paramsAttr = generateNewAttrName(paramsAttr, stmt.Arg)
+
+		// the path of JSON column is extracted in the dialect
+		if p, ok := parseJSONPath(value.Attr); ok {
+			paramsAttr = strings.Trim(paramNameRegexp.ReplaceAllString(value.Attr, "_"), "_")
+			value.Attr = p.expr(cb.Dialect, numericFilter(value))
+		}
+
+		// the param name is the key of clause slice too, it must be taken by neither args nor clauses, args of
+		// tuples and tags are named by the param name and index and clauses of null are without args
+		taken := make(map[string]interface{}, len(stmt.Arg)+len(stmt.ClauseSlice))
+		for k := range stmt.Arg {
+			taken[k] = nil
+		}
+		for k := range stmt.ClauseSlice {
+			taken[k] = nil
+		}
+
+		paramsAttr = generateNewAttrName(paramsAttr, taken)
+
+		// nil never equals to any value, compare it by IS NULL
+		if isNilValue(value.Val) {
+			switch value.Op {
+			case Equal:
+				value.Op = IsNull
+			case NotEqual:
+				value.Op = IsNotNull
+			}
+		}
+
+		switch value.Op {
+		case TupleIn, HasAny, HasAll, HasNone:
+			// args of tuples and tags are named by the param name and index, the name must be a word
+			paramsAttr = generateNewAttrName(paramNameRegexp.ReplaceAllString(paramsAttr, "_"), taken)
+		}
 
 		switch value.Op {
 		case StartsWith:
@@ -103,12 +180,30 @@ func Conditions(f *[]Filter, op LogicOperator) (stmt ConditionStmt, err error) {
 
 			break
 		case In:
-			str.WriteString(fmt.Sprintf("%s IN(:%s)", value.Attr, paramsAttr))
-			stmt.Arg[paramsAttr] = value.Val
+			vals, hasNil := splitNilValues(value.Val)
+
+			if !hasNil {
+				str.WriteString(fmt.Sprintf("%s IN(:%s)", value.Attr, paramsAttr))
+				stmt.Arg[paramsAttr] = value.Val
+			} else if len(vals) == 0 {
+				str.WriteString(fmt.Sprintf("%s IS NULL", value.Attr))
+			} else {
+				str.WriteString(fmt.Sprintf("(%s IN(:%s) OR %s IS NULL)", value.Attr, paramsAttr, value.Attr))
+				stmt.Arg[paramsAttr] = vals
+			}
 			break
 		case NotIn:
-			str.WriteString(fmt.Sprintf("%s NOT IN(:%s)", value.Attr, paramsAttr))
-			stmt.Arg[paramsAttr] = value.Val
+			vals, hasNil := splitNilValues(value.Val)
+
+			if !hasNil {
+				str.WriteString(fmt.Sprintf("%s NOT IN(:%s)", value.Attr, paramsAttr))
+				stmt.Arg[paramsAttr] = value.Val
+			} else if len(vals) == 0 {
+				str.WriteString(fmt.Sprintf("%s IS NOT NULL", value.Attr))
+			} else {
+				str.WriteString(fmt.Sprintf("(%s NOT IN(:%s) AND %s IS NOT NULL)", value.Attr, paramsAttr, value.Attr))
+				stmt.Arg[paramsAttr] = vals
+			}
 			break
 		case Between:
 			str.WriteString(fmt.Sprintf("%s >= :%s AND %s <= :%s",
@@ -135,6 +230,26 @@ func Conditions(f *[]Filter, op LogicOperator) (stmt ConditionStmt, err error) {
 		case IsNotNull:
 			str.WriteString(fmt.Sprintf("%s IS NOT NULL", value.Attr))
 			break
+		case TupleIn:
+			clause, err := cb.tupleIn(value.Attr, value.Val, paramsAttr, stmt.Arg)
+			if err != nil {
+				return stmt, errors.Wrap(err, "arg build failure")
+			}
+
+			str.WriteString(clause)
+		case NullSafeEqual:
+			str.WriteString(fmt.Sprintf("%s %s :%s", value.Attr, cb.nullSafeEqualOperator(), paramsAttr))
+			stmt.Arg[paramsAttr] = value.Val
+		case Matches, NotMatches, IMatches, NotIMatches:
+			str.WriteString(fmt.Sprintf("%s %s :%s", value.Attr, cb.regexpOperator(value.Op), paramsAttr))
+			stmt.Arg[paramsAttr] = cb.regexpPattern(value.Op, value.Val)
+		case HasAny, HasAll, HasNone:
+			clause, err := cb.tags(value, paramsAttr, stmt.Arg)
+			if err != nil {
+				return stmt, errors.Wrap(err, "arg build failure")
+			}
+
+			str.WriteString(clause)
 		default:
 			str.WriteString(fmt.Sprintf("%s %s :%s", value.Attr, value.Op, paramsAttr))
 			stmt.Arg[paramsAttr] = value.Val
@@ -149,6 +264,131 @@ func Conditions(f *[]Filter, op LogicOperator) (stmt ConditionStmt, err error) {
 	return stmt, nil
 }
 
+var paramNameRegexp = regexp.MustCompile(`\W+`)
+
+// Null safe equal operator of the dialect
+func (cb ConditionBuilder) nullSafeEqualOperator() string {
+	switch cb.Dialect {
+	case PostgreSQL:
+		return "IS NOT DISTINCT FROM"
+	case SQLite:
+		return "IS"
+	}
+
+	return "<=>"
+}
+
+func isNilValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map:
+		return rv.IsNil()
+	}
+
+	return false
+}
+
+// Values of the list without nil, and whether the list contains nil
+func splitNilValues(v interface{}) ([]interface{}, bool) {
+	rv := reflect.ValueOf(v)
+
+	if rv.Kind() != reflect.Slice {
+		return nil, false
+	}
+
+	var vals []interface{}
+	hasNil := false
+
+	for i := 0; i < rv.Len(); i++ {
+		if e := rv.Index(i).Interface(); isNilValue(e) {
+			hasNil = true
+		} else {
+			vals = append(vals, e)
+		}
+	}
+
+	return vals, hasNil
+}
+
+// Regular expression operator of the dialect
+func (cb ConditionBuilder) regexpOperator(op Operator) string {
+	if cb.Dialect == PostgreSQL {
+		switch op {
+		case NotMatches:
+			return "!~"
+		case IMatches:
+			return "~*"
+		case NotIMatches:
+			return "!~*"
+		}
+		return "~"
+	}
+
+	if op == NotMatches || op == NotIMatches {
+		return "NOT REGEXP"
+	}
+	return "REGEXP"
+}
+
+// Regular expression pattern of the dialect, the case insensitive flag is prefixed where REGEXP has no such operator
+func (cb ConditionBuilder) regexpPattern(op Operator, v interface{}) interface{} {
+	if cb.Dialect == PostgreSQL || (op != IMatches && op != NotIMatches) {
+		return v
+	}
+
+	return "(?i)" + fmt.Sprint(v)
+}
+
+// Render the tuples IN, as row values on MySQL and PostgreSQL, and OR of ANDs on SQLite
+func (cb ConditionBuilder) tupleIn(attr string, v interface{}, name string, params map[string]interface{}) (string, error) {
+	columns := strings.Split(attr, ",")
+	for i := range columns {
+		columns[i] = strings.TrimSpace(columns[i])
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice || rv.Len() == 0 {
+		return "", errors.New("tuple in value must be non empty slice")
+	}
+
+	var rows []string
+
+	for i := 0; i < rv.Len(); i++ {
+		tuple := reflect.ValueOf(rv.Index(i).Interface())
+		if tuple.Kind() != reflect.Slice || tuple.Len() != len(columns) {
+			return "", fmt.Errorf("tuple %d must have %d values", i, len(columns))
+		}
+
+		var values []string
+		for j := range columns {
+			key := fmt.Sprintf("%s_%d_%d", name, i, j)
+			params[key] = tuple.Index(j).Interface()
+
+			if cb.Dialect != SQLite {
+				values = append(values, ":"+key)
+			} else {
+				values = append(values, fmt.Sprintf("%s = :%s", columns[j], key))
+			}
+		}
+
+		if cb.Dialect != SQLite {
+			rows = append(rows, fmt.Sprintf("(%s)", strings.Join(values, ", ")))
+		} else {
+			rows = append(rows, fmt.Sprintf("(%s)", strings.Join(values, " AND ")))
+		}
+	}
+
+	if cb.Dialect != SQLite {
+		return fmt.Sprintf("(%s) IN (%s)", strings.Join(columns, ", "), strings.Join(rows, ", ")), nil
+	}
+
+	return fmt.Sprintf("(%s)", strings.Join(rows, " OR ")), nil
+}
+
 func generateNewAttrName(s string, args map[string]interface{}) string {
 	var (
 		i  int64
@@ -172,17 +412,74 @@ func generateNewAttrName(s string, args map[string]interface{}) string {
 	return s
 }
 
-func numberSuffixMatch(s string) (prefix, suffix string) {
-	r := regexp.MustCompile(`(\w+_?)+_(\d)+$`)
-	ms := r.FindAllStringSubmatch(s, -1)
+// Rename the args of stmt which already exist in taken, placeholders in the clause and clause slice are renamed
+// too, so that statements of different scopes could be bound with one arg map
+func rebaseArgs(stmt ConditionStmt, taken map[string]interface{}) ConditionStmt {
+	used := make(map[string]interface{}, len(taken)+len(stmt.Arg))
+	for k, v := range taken {
+		used[k] = v
+	}
+	for k, v := range stmt.Arg {
+		used[k] = v
+	}
 
-	if len(ms) == 0 {
-		return "", ""
+	keys := make([]string, 0, len(stmt.Arg))
+	for k := range stmt.Arg {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	renames := map[string]string{}
+	for _, k := range keys {
+		if _, ok := taken[k]; !ok {
+			continue
+		}
+
+		nk := generateNewAttrName(k, used)
+		used[nk] = stmt.Arg[k]
+		renames[k] = nk
+	}
+
+	if len(renames) == 0 {
+		return stmt
+	}
+
+	rename := func(s string) string {
+		return placeholderRegexp.ReplaceAllStringFunc(s, func(m string) string {
+			// skip the postgres type cast such as ::numeric
+			if strings.HasPrefix(m, "::") {
+				return m
+			}
+			if nk, ok := renames[m[1:]]; ok {
+				return ":" + nk
+			}
+			return m
+		})
+	}
+
+	res := ConditionStmt{
+		Clause:      rename(stmt.Clause),
+		Arg:         make(map[string]interface{}, len(stmt.Arg)),
+		ClauseSlice: make(map[string]string, len(stmt.ClauseSlice)),
+	}
+
+	for k, v := range stmt.Arg {
+		if nk, ok := renames[k]; ok {
+			res.Arg[nk] = v
+		} else {
+			res.Arg[k] = v
+		}
 	}
 
-	return ms[0][1], ms[0][2]
+	for k, cs := range stmt.ClauseSlice {
+		res.ClauseSlice[k] = rename(cs)
+	}
+
+	return res
 }
 
+var placeholderRegexp = regexp.MustCompile(`::?\w+`)
+
 func WhereOr(f *[]Filter) (stmt ConditionStmt, err error) {
 	return Conditions(f, OR)
 }
@@ -207,33 +504,12 @@ func Combine(op LogicOperator, stmts ...ConditionStmt) (stmt ConditionStmt) {
 
 	for _, s := range stmts {
 		if s.Clause != "" {
+			// replace to new placeholders when args name conflicted
+			s = rebaseArgs(s, stmt.Arg)
 			c := s.Clause
 
-			keys := make([]string, 0, len(s.Arg))
-
-			for k := range s.Arg {
-				keys = append(keys, k)
-			}
-			sort.Strings(keys)
-
-			for _, k := range keys {
-				nk := generateNewAttrName(k, stmt.Arg)
-				// replace to new placeholder
-
-				c = strings.Replace(c, ":"+k, ":"+nk, 1)
-
-				ps, _ := numberSuffixMatch(k)
-				if ps != "" {
-					if _, ok := s.ClauseSlice[ps]; ok {
-						s.ClauseSlice[ps] = strings.Replace(s.ClauseSlice[ps], ":"+k, ":"+nk, 1)
-					}
-				} else {
-					if _, ok := s.ClauseSlice[k]; ok {
-						s.ClauseSlice[k] = strings.Replace(s.ClauseSlice[k], ":"+k, ":"+nk, 1)
-					}
-				}
-
-				stmt.Arg[nk] = s.Arg[k]
+			for k, v := range s.Arg {
+				stmt.Arg[k] = v
 			}
 
 			for k, cs := range s.ClauseSlice {
@@ -284,23 +560,22 @@ func betweenParamsProcess(v interface{}, attr string, params map[string]interfac
 	}
 
 	if k == reflect.Interface {
-		params[attr+"_1"] = s.Index(0).Elem().String()
-		params[attr+"_2"] = s.Index(1).Elem().String()
-
-		if params[attr+"_1"] == "<int Value>" {
-			params[attr+"_1"] = s.Index(0).Elem().Int()
-		}
-
-		if params[attr+"_2"] == "<int Value>" {
-			params[attr+"_2"] = s.Index(1).Elem().Int()
-		}
-
-		if params[attr+"_1"] == "<float64 Value>" {
-			params[attr+"_1"] = s.Index(0).Elem().Float()
-		}
-
-		if params[attr+"_2"] == "<float64 Value>" {
-			params[attr+"_2"] = s.Index(1).Elem().Float()
+		for i, key := range []string{attr + "_1", attr + "_2"} {
+			e := s.Index(i).Elem()
+
+			switch e.Kind() {
+			case reflect.Int:
+				params[key] = e.Int()
+			case reflect.Float64:
+				params[key] = e.Float()
+			case reflect.String:
+				params[key] = e.String()
+			case reflect.Invalid:
+				params[key] = nil
+			default:
+				// coerced values such as int64, bool and time
+				params[key] = e.Interface()
+			}
 		}
 	}
 
@@ -336,6 +611,63 @@ type Expander interface {
 	Expand(origFilter Filter) (ConditionStmt, error)
 }
 
+// ExpansionContext carry the request data to expanders
+type ExpansionContext struct {
+	Context context.Context
+	// DB of the builder, nil if the builder has no DB
+	DB      sqlx.QueryerContext
+	Dialect Dialect
+	// Attributes declared by the composition, nested conditions of expanders follow them
+	Attributes map[string]AttributeDefinition
+	// User of the request, such as the current user for permission aware filters
+	User interface{}
+	// Cache of the lookup ids, nil disable the cache
+	LookupCache *LookupCache
+}
+
+// Condition builder of the dialect and attributes, expanders build the nested conditions by it
+func (ec ExpansionContext) ConditionBuilder() ConditionBuilder {
+	return ConditionBuilder{Dialect: ec.Dialect, Attributes: ec.Attributes}
+}
+
+// ContextExpander is the expander need the request data or query the database, the builder call ExpandContext
+// instead of Expand
+type ContextExpander interface {
+	Expander
+	ExpandContext(ec ExpansionContext, origFilter Filter) (ConditionStmt, error)
+}
+
+// FieldExpander is the expander expose fields depend on the filter, such as the relevance score of search.
+// Clause of the fields statement is the field list render to %fields.<pipeline attr> token, and the default fields
+// render when the filter of pipeline is absent
+type FieldExpander interface {
+	Expander
+	ExpandFields(origFilter Filter) (ConditionStmt, error)
+	DefaultFields() string
+}
+
+// ContextFieldExpander is the field expander need the request data, the builder call ExpandFieldsContext instead
+// of ExpandFields
+type ContextFieldExpander interface {
+	FieldExpander
+	ExpandFieldsContext(ec ExpansionContext, origFilter Filter) (ConditionStmt, error)
+}
+
+// FilterRewriter is the expander emit new filters instead of the condition, the emitted filters are combined by
+// the logic operator of group, and go through the pipelines again, so that pipelines could be chained such as
+// synonyms followed by fulltext
+type FilterRewriter interface {
+	Expander
+	Rewrite(origFilter Filter) (FilterGroup, error)
+}
+
+// TargetedRewriter is the rewriter knows the attrs of emitted filters ahead, the builder check the cycle of chained
+// pipelines on construction instead of on the filters
+type TargetedRewriter interface {
+	FilterRewriter
+	RewriteTargets() []string
+}
+
 type FilterPipeline struct {
 	Attr      string
 	CombineOp LogicOperator
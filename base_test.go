@@ -1,12 +1,14 @@
 package sqlcomposer
 
 import (
+	"database/sql"
 	"fmt"
+	"regexp"
 	"strings"
 	"testing"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -95,8 +97,17 @@ drop table orders;
 }
 
 func init() {
+	// SQLite has no builtin REGEXP, X REGEXP Y calls regexp(Y, X)
+	sql.Register("sqlite3_regexp", &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("regexp", func(re, s string) (bool, error) {
+				return regexp.MatchString(re, s)
+			}, true)
+		},
+	})
+
 	var err error
-	db, err = sqlx.Connect("sqlite3", ":memory:")
+	db, err = sqlx.Connect("sqlite3_regexp", ":memory:")
 	if err != nil {
 		fmt.Printf("Disabling SQLite:\n    %v", err)
 	}
@@ -450,6 +461,68 @@ func TestBuildWhereOr(t *testing.T) {
 	}, s5.Arg)
 }
 
+func TestConditionBuilder_TupleIn(t *testing.T) {
+	f := &[]Filter{
+		{Val: [][]interface{}{{1, "001"}, {2, "003"}}, Op: TupleIn, Attr: "orders.uid, orders.order_no"},
+		{Val: [][]int{{1, 2}}, Op: TupleIn, Attr: "orders.uid, orders.order_no"},
+	}
+
+	s, err := Conditions(f, AND)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "(orders.uid, orders.order_no) IN ((:orders_uid_orders_order_no_0_0, :orders_uid_orders_order_no_0_1), "+
+		"(:orders_uid_orders_order_no_1_0, :orders_uid_orders_order_no_1_1)) AND "+
+		"(orders.uid, orders.order_no) IN ((:orders_uid_orders_order_no_1_0_0, :orders_uid_orders_order_no_1_0_1))", s.Clause)
+	assert.Equal(t, map[string]interface{}{
+		"orders_uid_orders_order_no_0_0":   1,
+		"orders_uid_orders_order_no_0_1":   "001",
+		"orders_uid_orders_order_no_1_0":   2,
+		"orders_uid_orders_order_no_1_1":   "003",
+		"orders_uid_orders_order_no_1_0_0": 1,
+		"orders_uid_orders_order_no_1_0_1": 2,
+	}, s.Arg)
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		s, err := ConditionBuilder{Dialect: SQLite}.WhereAnd(&[]Filter{
+			{Val: [][]interface{}{{1, "001"}, {2, "003"}, {3, "001"}}, Op: TupleIn, Attr: "orders.uid,orders.order_no"},
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "((orders.uid = :orders_uid_orders_order_no_0_0 AND orders.order_no = :orders_uid_orders_order_no_0_1) OR "+
+			"(orders.uid = :orders_uid_orders_order_no_1_0 AND orders.order_no = :orders_uid_orders_order_no_1_1) OR "+
+			"(orders.uid = :orders_uid_orders_order_no_2_0 AND orders.order_no = :orders_uid_orders_order_no_2_1))", s.Clause)
+
+		q, a, err := bindNamed("SELECT id FROM orders WHERE "+s.Clause+" ORDER BY id", s.Arg, sqlx.QUESTION)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []int
+		err = db.Select(&ids, q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []int{1, 3}, ids)
+	})
+
+	_, err = Conditions(&[]Filter{{Val: [][]int{{1}}, Op: TupleIn, Attr: "a,b"}}, AND)
+	assert.Error(t, err)
+
+	_, err = Conditions(&[]Filter{{Val: [][]int{}, Op: TupleIn, Attr: "a,b"}}, AND)
+	assert.Error(t, err)
+}
+
 func TestFilterToWhereAnd(t *testing.T) {
 	p1 := FilterPipeline{
 		Attr:      "name",
@@ -575,3 +648,205 @@ func TestCollectTokenPlaceholder(t *testing.T) {
 	assert.Equal(t, "{!name,age}", tks[1][2])
 	assert.Equal(t, "{name,age}", tks[2][2])
 }
+
+func Test_rebaseArgs(t *testing.T) {
+	s1, _ := WhereAnd(&[]Filter{
+		{Val: "wang", Op: Equal, Attr: "name"},
+		{Val: []int{10, 15}, Op: Between, Attr: "age"},
+	})
+
+	rebased := rebaseArgs(s1, map[string]interface{}{
+		"name":  "barry",
+		"age_1": 10,
+	})
+
+	assert.Equal(t, "name = :name_1 AND age >= :age_3 AND age <= :age_2", rebased.Clause)
+	assert.Equal(t, map[string]interface{}{
+		"name_1": "wang",
+		"age_3":  int64(10),
+		"age_2":  int64(15),
+	}, rebased.Arg)
+	assert.Equal(t, "age >= :age_3 AND age <= :age_2", rebased.ClauseSlice["age"])
+
+	// nothing to rename
+	assert.Equal(t, s1, rebaseArgs(s1, map[string]interface{}{"foo": 1}))
+}
+
+func TestConditionBuilder_Regexp(t *testing.T) {
+	f := &[]Filter{
+		{Val: "^S", Op: Matches, Attr: "users.name"},
+		{Val: "y$", Op: NotMatches, Attr: "users.name"},
+	}
+
+	s, err := Conditions(f, AND)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "users.name REGEXP :users_name AND users.name NOT REGEXP :users_name_1", s.Clause)
+	assert.Equal(t, map[string]interface{}{"users_name": "^S", "users_name_1": "y$"}, s.Arg)
+
+	s, err = ConditionBuilder{Dialect: PostgreSQL}.WhereAnd(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "users.name ~ :users_name AND users.name !~ :users_name_1", s.Clause)
+
+	f = &[]Filter{
+		{Val: "^s", Op: IMatches, Attr: "users.name"},
+		{Val: "Y$", Op: NotIMatches, Attr: "users.name"},
+	}
+
+	s, err = Conditions(f, AND)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "users.name REGEXP :users_name AND users.name NOT REGEXP :users_name_1", s.Clause)
+	assert.Equal(t, map[string]interface{}{"users_name": "(?i)^s", "users_name_1": "(?i)Y$"}, s.Arg)
+
+	s, err = ConditionBuilder{Dialect: PostgreSQL}.WhereAnd(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "users.name ~* :users_name AND users.name !~* :users_name_1", s.Clause)
+	assert.Equal(t, map[string]interface{}{"users_name": "^s", "users_name_1": "Y$"}, s.Arg)
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		sb, err := NewSqlBuilder(db, []byte(`
+info:
+  name: example
+  version: 1.0.0
+composition:
+  fields:
+    base:
+      - name: name
+        expr: users.name
+  subject:
+    list: "SELECT %fields.base FROM users %where ORDER BY users.uid"`))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: "^[SZ]", Op: Matches, Attr: "users.name"},
+			{Val: "e$", Op: NotMatches, Attr: "users.name"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		if err = db.Select(&names, q, a...); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"Scott"}, names)
+
+		sb.Reset()
+
+		err = sb.AddFilters([]Filter{
+			{Val: "^[sz]", Op: IMatches, Attr: "users.name"},
+			{Val: "E$", Op: NotIMatches, Attr: "users.name"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err = sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		names = nil
+		if err = db.Select(&names, q, a...); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"Scott"}, names)
+	})
+}
+
+func TestConditionBuilder_Nil(t *testing.T) {
+	s, err := Conditions(&[]Filter{
+		{Val: nil, Op: Equal, Attr: "users.age"},
+		{Val: (*int)(nil), Op: NotEqual, Attr: "users.age"},
+		{Val: []interface{}{20, nil}, Op: In, Attr: "users.age"},
+		{Val: []interface{}{nil}, Op: NotIn, Attr: "users.age"},
+		{Val: nil, Op: NullSafeEqual, Attr: "users.age"},
+	}, AND)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "users.age IS NULL AND users.age IS NOT NULL AND (users.age IN(:users_age_2) OR users.age IS NULL) AND "+
+		"users.age IS NOT NULL AND users.age <=> :users_age_4", s.Clause)
+	assert.Equal(t, map[string]interface{}{"users_age_2": []interface{}{20}, "users_age_4": nil}, s.Arg)
+	assert.Len(t, s.ClauseSlice, 5)
+	assert.Equal(t, "users.age IS NULL", s.ClauseSlice["users_age"])
+
+	s, err = ConditionBuilder{Dialect: PostgreSQL}.WhereAnd(&[]Filter{{Val: 1, Op: NullSafeEqual, Attr: "users.age"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "users.age IS NOT DISTINCT FROM :users_age", s.Clause)
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+		db.MustExec("INSERT INTO users (uid, name, age) VALUES (4, 'Nobody', NULL)")
+
+		cases := []struct {
+			filter Filter
+			uids   []int
+		}{
+			{Filter{Val: nil, Op: Equal, Attr: "users.age"}, []int{4}},
+			{Filter{Val: nil, Op: NotEqual, Attr: "users.age"}, []int{1, 2, 3}},
+			{Filter{Val: []interface{}{20, nil}, Op: In, Attr: "users.age"}, []int{1, 4}},
+			{Filter{Val: []interface{}{20, nil}, Op: NotIn, Attr: "users.age"}, []int{2, 3}},
+			{Filter{Val: nil, Op: NullSafeEqual, Attr: "users.age"}, []int{4}},
+			{Filter{Val: 24, Op: NullSafeEqual, Attr: "users.age"}, []int{2, 3}},
+		}
+
+		for _, c := range cases {
+			s, err := ConditionBuilder{Dialect: SQLite}.WhereAnd(&[]Filter{c.filter})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			q, a, err := bindNamed("SELECT uid FROM users WHERE "+s.Clause+" ORDER BY uid", s.Arg, sqlx.QUESTION)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var uids []int
+			if err = db.Select(&uids, q, a...); err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, c.uids, uids, c.filter)
+		}
+	})
+}
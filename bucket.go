@@ -0,0 +1,143 @@
+package sqlcomposer
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Bucket is the named range of attr, such as 18-24 of age
+type Bucket struct {
+	Label string
+	Op    Operator
+	Val   interface{}
+}
+
+// BucketExpander expand the bucket labels to the conditions of buckets, labels are combined by OR
+//
+//	filterPipelines:
+//	  age_bucket:
+//	    type: bucket
+//	    params:
+//	      - name: attr
+//	        value: users.age
+//	      - name: buckets
+//	        value:
+//	          - label: 18-24
+//	            op: between
+//	            val: [18, 24]
+//	          - label: ">60"
+//	            op: ">"
+//	            val: 60
+//
+// The filter value is the label or list of labels, operators not_in and <> negate the buckets
+type BucketExpander struct {
+	Attr    string
+	Buckets []Bucket
+}
+
+// Expand the buckets in the syntax of MySQL, use ExpandContext for the dialect of builder
+func (e *BucketExpander) Expand(origFilter Filter) (ConditionStmt, error) {
+	return e.expand(ConditionBuilder{Dialect: MySQL}, origFilter)
+}
+
+func (e *BucketExpander) ExpandContext(ec ExpansionContext, origFilter Filter) (ConditionStmt, error) {
+	return e.expand(ec.ConditionBuilder(), origFilter)
+}
+
+func (e *BucketExpander) expand(cb ConditionBuilder, origFilter Filter) (ConditionStmt, error) {
+	var labels []string
+
+	rv := reflect.ValueOf(origFilter.Val)
+	if rv.Kind() == reflect.Slice {
+		for i := 0; i < rv.Len(); i++ {
+			labels = append(labels, fmt.Sprint(rv.Index(i).Interface()))
+		}
+	} else {
+		labels = append(labels, fmt.Sprint(origFilter.Val))
+	}
+
+	if len(labels) == 0 {
+		return ConditionStmt{}, fmt.Errorf("%s bucket labels are empty", origFilter.Attr)
+	}
+
+	var stmts []ConditionStmt
+
+	for _, label := range labels {
+		b, ok := e.bucket(label)
+
+		if !ok {
+			return ConditionStmt{}, fmt.Errorf("%s bucket %s not exists", origFilter.Attr, label)
+		}
+
+		stmt, err := cb.WhereAnd(&[]Filter{{Attr: e.Attr, Op: b.Op, Val: b.Val}})
+
+		if err != nil {
+			return stmt, err
+		}
+
+		stmts = append(stmts, stmt)
+	}
+
+	stmt := stmts[0]
+	if len(stmts) > 1 {
+		stmt = CombineOr(stmts...)
+	}
+
+	switch origFilter.Op {
+	case NotEqual, NotIn:
+		stmt.Clause = fmt.Sprintf("NOT (%s)", stmt.Clause)
+	}
+
+	// the buckets are one condition of the pipeline attr
+	key := paramNameRegexp.ReplaceAllString(origFilter.Attr, "_")
+	stmt.ClauseSlice = map[string]string{key: stmt.Clause}
+
+	return stmt, nil
+}
+
+func (e *BucketExpander) bucket(label string) (Bucket, bool) {
+	for _, b := range e.Buckets {
+		if b.Label == label {
+			return b, true
+		}
+	}
+
+	return Bucket{}, false
+}
+
+// Buckets of the yaml param value, nil if any bucket is invalid
+func bucketsOf(v interface{}) []Bucket {
+	list, ok := v.([]interface{})
+
+	if !ok || len(list) == 0 {
+		return nil
+	}
+
+	var buckets []Bucket
+
+	for _, item := range list {
+		m, ok := item.(map[interface{}]interface{})
+
+		if !ok {
+			return nil
+		}
+
+		b := Bucket{
+			Label: fmt.Sprint(m["label"]),
+			Op:    Operator(fmt.Sprint(m["op"])),
+			Val:   m["val"],
+		}
+
+		if m["label"] == nil || m["op"] == nil {
+			return nil
+		}
+
+		if _, err := WhereAnd(&[]Filter{{Attr: "bucket", Op: b.Op, Val: b.Val}}); err != nil {
+			return nil
+		}
+
+		buckets = append(buckets, b)
+	}
+
+	return buckets
+}
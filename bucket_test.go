@@ -0,0 +1,149 @@
+package sqlcomposer
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBucketExpander(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  filterPipelines:
+    amount:
+      type: bucket
+      params:
+        - name: attr
+          value: orders.total_amount
+        - name: buckets
+          value:
+            - label: "<20"
+              op: "<"
+              val: 20
+            - label: "20-100"
+              op: between
+              val: [20, 100]
+            - label: ">100"
+              op: ">"
+              val: 100
+  fields:
+    base:
+      - name: order_no
+        expr: orders.order_no
+  subject:
+    list: "SELECT %fields.base FROM orders %where ORDER BY orders.id"`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: "20-100", Op: Equal, Attr: "amount"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT orders.order_no AS order_no FROM orders "+
+			"WHERE ((orders.total_amount >= ? AND orders.total_amount <= ?)) ORDER BY orders.id", q)
+		assert.Equal(t, []interface{}{int64(20), int64(100)}, a)
+
+		var nos []string
+		err = db.Select(&nos, q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"002", "003"}, nos)
+
+		sb.Reset()
+		err = sb.AddFilters([]Filter{
+			{Val: []string{"<20", ">100"}, Op: In, Attr: "amount"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err = sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		nos = nil
+		err = db.Select(&nos, q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"001", "004"}, nos)
+
+		sb.Reset()
+		err = sb.AddFilters([]Filter{
+			{Val: []string{"<20", ">100"}, Op: NotIn, Attr: "amount"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err = sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		nos = nil
+		err = db.Select(&nos, q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"002", "003"}, nos)
+
+		sb.Reset()
+		err = sb.AddFilters([]Filter{
+			{Val: "1000+", Op: Equal, Attr: "amount"},
+		}, AND)
+		assert.Error(t, err)
+	})
+
+	_, err := NewSqlBuilder(nil, []byte(`
+info:
+  name: example
+  version: 1.0.0
+composition:
+  filterPipelines:
+    amount:
+      type: bucket
+      params:
+        - name: attr
+          value: orders.total_amount
+        - name: buckets
+          value:
+            - label: "20-100"
+              op: between
+              val: 20
+  subject:
+    list: "SELECT * FROM orders %where"`))
+	assert.Error(t, err)
+}
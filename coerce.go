@@ -0,0 +1,154 @@
+package sqlcomposer
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types the string filter values coerce to
+const (
+	TypeInt     = "int"
+	TypeFloat   = "float"
+	TypeBool    = "bool"
+	TypeTime    = "time"
+	TypeDecimal = "decimal"
+	TypeString  = "string"
+)
+
+var (
+	decimalRegexp = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)$`)
+	timeLayouts   = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+)
+
+// ValidationError is the filter value could not coerce to the type of attr
+type ValidationError struct {
+	Attr string
+	Val  interface{}
+	Type string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s value %v is not a valid %s", e.Attr, e.Val, e.Type)
+}
+
+func validType(t string) bool {
+	switch t {
+	case "", TypeInt, TypeFloat, TypeBool, TypeTime, TypeDecimal, TypeString:
+		return true
+	}
+
+	return false
+}
+
+// Attributes of doc with the types of fields, the field type applies to both the name and expr of field, and the
+// type declared by attributes is preferred
+func docAttributes(doc *SqlApiDoc) map[string]AttributeDefinition {
+	attributes := make(map[string]AttributeDefinition, len(doc.Composition.Attributes))
+	for k, a := range doc.Composition.Attributes {
+		attributes[k] = a
+	}
+
+	var groups []string
+	for k := range doc.Composition.Fields {
+		groups = append(groups, k)
+	}
+	sort.Strings(groups)
+
+	for _, g := range groups {
+		for _, f := range doc.Composition.Fields[g] {
+			if f.Type == "" || !validType(f.Type) {
+				continue
+			}
+
+			for _, attr := range []string{f.Name, f.Expr} {
+				if a := attributes[attr]; a.Type == "" {
+					a.Type = f.Type
+					attributes[attr] = a
+				}
+			}
+		}
+	}
+
+	return attributes
+}
+
+// Coerce the string value of filter to the type of attr, elements of list value are coerced too
+func (cb ConditionBuilder) coerce(f Filter) (interface{}, error) {
+	t := cb.Attributes[f.Attr].Type
+
+	switch f.Op {
+	case StartsWith, Contains, EndsWith, Matches, NotMatches, IMatches, NotIMatches, IsNull, IsNotNull, TupleIn:
+		return f.Val, nil
+	}
+
+	if t == "" || t == TypeString {
+		return f.Val, nil
+	}
+
+	rv := reflect.ValueOf(f.Val)
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+		vals := make([]interface{}, rv.Len())
+
+		for i := 0; i < rv.Len(); i++ {
+			v, err := coerceValue(rv.Index(i).Interface(), t)
+
+			if err != nil {
+				return nil, &ValidationError{Attr: f.Attr, Val: rv.Index(i).Interface(), Type: t}
+			}
+
+			vals[i] = v
+		}
+
+		return vals, nil
+	}
+
+	v, err := coerceValue(f.Val, t)
+
+	if err != nil {
+		return nil, &ValidationError{Attr: f.Attr, Val: f.Val, Type: t}
+	}
+
+	return v, nil
+}
+
+// Coerce the string to type, values of other types are returned as is. Decimal is validated and kept as string so
+// that the precision is not lost
+func coerceValue(v interface{}, t string) (interface{}, error) {
+	s, ok := v.(string)
+
+	if !ok {
+		return v, nil
+	}
+
+	s = strings.TrimSpace(s)
+
+	switch t {
+	case TypeInt:
+		return strconv.ParseInt(s, 10, 64)
+	case TypeFloat:
+		return strconv.ParseFloat(s, 64)
+	case TypeBool:
+		return strconv.ParseBool(s)
+	case TypeTime:
+		for _, layout := range timeLayouts {
+			if tm, err := time.Parse(layout, s); err == nil {
+				return tm, nil
+			}
+		}
+
+		return nil, fmt.Errorf("%s is not a valid time", s)
+	case TypeDecimal:
+		if !decimalRegexp.MatchString(s) {
+			return nil, fmt.Errorf("%s is not a valid decimal", s)
+		}
+
+		return s, nil
+	}
+
+	return v, nil
+}
@@ -0,0 +1,124 @@
+package sqlcomposer
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_coerceValue(t *testing.T) {
+	v, err := coerceValue(" 30 ", TypeInt)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(30), v)
+
+	v, err = coerceValue("1.5", TypeFloat)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, v)
+
+	v, err = coerceValue("true", TypeBool)
+	assert.NoError(t, err)
+	assert.Equal(t, true, v)
+
+	v, err = coerceValue("2020-04-01", TypeTime)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), v)
+
+	v, err = coerceValue("-12.50", TypeDecimal)
+	assert.NoError(t, err)
+	assert.Equal(t, "-12.50", v)
+
+	v, err = coerceValue(30, TypeString)
+	assert.NoError(t, err)
+	assert.Equal(t, 30, v)
+
+	_, err = coerceValue("1e3", TypeDecimal)
+	assert.Error(t, err)
+
+	_, err = coerceValue("yesterday", TypeTime)
+	assert.Error(t, err)
+}
+
+func TestSqlBuilder_Coerce(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  attributes:
+    users.age:
+      type: int
+  fields:
+    base:
+      - name: name
+        expr: users.name
+    statistic:
+      - name: consume_total
+        expr: SUM(orders.total_amount)
+        type: float
+  subject:
+    list: "SELECT %fields.base, %fields.statistic FROM users LEFT JOIN orders ON orders.uid = users.uid %where{!consume_total} GROUP BY users.uid %having{consume_total} ORDER BY users.uid"`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: []string{"18", "22"}, Op: Between, Attr: "users.age"},
+			{Val: "100", Op: Greater, Attr: "consume_total"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []interface{}{int64(18), int64(22), 100.0}, a)
+
+		var rows []struct {
+			Name  string  `db:"name"`
+			Total float64 `db:"consume_total"`
+		}
+		if err = db.Select(&rows, q, a...); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Len(t, rows, 1)
+		assert.Equal(t, "Scott", rows[0].Name)
+
+		sb.Reset()
+		err = sb.AddFilters([]Filter{
+			{Val: []string{"20", "twenty"}, Op: In, Attr: "users.age"},
+		}, AND)
+
+		assert.Error(t, err)
+
+		verr, ok := errors.Cause(err).(*ValidationError)
+		assert.True(t, ok)
+		assert.Equal(t, "users.age", verr.Attr)
+		assert.Equal(t, "twenty", verr.Val)
+	})
+
+	_, err := NewSqlBuilder(nil, []byte(`
+info:
+  name: example
+  version: 1.0.0
+composition:
+  attributes:
+    users.age:
+      type: integer
+  subject:
+    list: "SELECT * FROM users %where"`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,133 @@
+package sqlcomposer
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+type DefaultConditionMode string
+
+const (
+	// Always ANDed to the conditions, it is the mode when not declared
+	Mandatory DefaultConditionMode = "mandatory"
+	// Replaced when the user filters the same attr in the same scope
+	Overridable = "overridable"
+	// Dropped when removed by RemoveDefaultCondition
+	Removable = "removable"
+)
+
+// DefaultCondition is a filter declared in the composition doc, it is applied to every subject by its mode
+//
+//	defaultConditions:
+//	  - attr: users.name
+//	    op: contains
+//	    val: Barry
+//	    mode: overridable
+type DefaultCondition struct {
+	Filter `yaml:",inline"`
+	Mode   DefaultConditionMode `yaml:"mode,omitempty"`
+}
+
+func (dc DefaultCondition) validate() error {
+	switch dc.Mode {
+	case "", Mandatory, Overridable, Removable:
+	default:
+		return fmt.Errorf("%s default condition mode %s is not supported", dc.Attr, dc.Mode)
+	}
+
+	_, err := WhereAnd(&[]Filter{dc.Filter})
+
+	return err
+}
+
+type scopedAttr struct {
+	Scope string
+	Attr  string
+}
+
+// Remove the removable default conditions of attr, of the doc and subjects
+func (sc *SqlBuilder) RemoveDefaultCondition(attr string) error {
+	found := false
+
+	dcs := append([]DefaultCondition{}, sc.Doc.Composition.DefaultConditions...)
+	for _, def := range sc.Doc.Composition.Subject {
+		dcs = append(dcs, def.DefaultConditions...)
+	}
+
+	for _, dc := range dcs {
+		if dc.Attr != attr {
+			continue
+		}
+
+		if dc.Mode != Removable {
+			return fmt.Errorf("%s default condition is not removable", attr)
+		}
+
+		found = true
+	}
+
+	if !found {
+		return fmt.Errorf("%s default condition not exists", attr)
+	}
+
+	sc.removed[attr] = true
+
+	return nil
+}
+
+// Default conditions of doc applied to the composed subjects
+func (sc *SqlBuilder) AppliedDefaultConditions() []DefaultCondition {
+	return sc.appliedDefaults(sc.Doc.Composition.DefaultConditions)
+}
+
+func (sc *SqlBuilder) appliedDefaults(dcs []DefaultCondition) []DefaultCondition {
+	var applied []DefaultCondition
+
+	for _, dc := range dcs {
+		if sc.defaultApplied(dc) {
+			applied = append(applied, dc)
+		}
+	}
+
+	return applied
+}
+
+func (sc *SqlBuilder) defaultApplied(dc DefaultCondition) bool {
+	switch dc.Mode {
+	case Overridable:
+		return !sc.filtered[scopedAttr{Scope: dc.Scope, Attr: dc.Attr}]
+	case Removable:
+		return !sc.removed[dc.Attr]
+	}
+
+	return true
+}
+
+// Applied default conditions of the scope ANDed with the conditions of the scope
+func (sc *SqlBuilder) effectiveConditions(scope string, def SubjectDefinition, st *subjectState) (ConditionStmt, error) {
+	var filters []Filter
+
+	for _, dc := range sc.appliedDefaults(def.defaultConditions(sc.Doc)) {
+		if dc.Scope == scope {
+			filters = append(filters, dc.Filter)
+		}
+	}
+
+	conditions := st.conditions(scope)
+
+	if len(filters) == 0 {
+		return conditions, nil
+	}
+
+	defaults, err := sc.conditionBuilder().WhereAnd(&filters)
+
+	if err != nil {
+		return defaults, errors.Wrap(err, "default conditions process failure")
+	}
+
+	if conditions.IsEmpty() {
+		return defaults, nil
+	}
+
+	return CombineAnd(defaults, conditions), nil
+}
@@ -0,0 +1,108 @@
+package sqlcomposer
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSqlBuilder_DefaultConditionModes(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  fields:
+    base:
+      - name: name
+        expr: users.name
+      - name: age
+        expr: users.age
+  defaultConditions:
+    - attr: users.name
+      op: contains
+      val: Barry
+      mode: overridable
+    - attr: users.age
+      op: ">"
+      val: 10
+    - attr: users.uid
+      op: "<>"
+      val: 0
+      mode: removable
+  subject:
+    list: "SELECT %fields.base FROM users %where ORDER BY users.uid"`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Len(t, sb.AppliedDefaultConditions(), 3)
+
+		q, _, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name, users.age AS age FROM users "+
+			"WHERE users.name LIKE ? AND users.age > ? AND users.uid <> ? ORDER BY users.uid", q)
+
+		err = sb.AddFilters([]Filter{
+			{Val: "Zoe", Op: Contains, Attr: "users.name"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Error(t, sb.RemoveDefaultCondition("users.age"))
+		assert.Error(t, sb.RemoveDefaultCondition("users.sex"))
+		assert.NoError(t, sb.RemoveDefaultCondition("users.uid"))
+
+		assert.Equal(t, []DefaultCondition{
+			{Filter: Filter{Attr: "users.age", Op: Greater, Val: 10}},
+		}, sb.AppliedDefaultConditions())
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name, users.age AS age FROM users "+
+			"WHERE (users.age > ?) AND ((users.name LIKE ?)) ORDER BY users.uid", q)
+
+		rows, err := db.Queryx(q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, true, rows.Next())
+		row := make(map[string]interface{})
+		err = rows.MapScan(row)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "Zoe", row["name"])
+		assert.Equal(t, false, rows.Next())
+	})
+
+	_, err := NewSqlBuilder(nil, []byte(`
+composition:
+  defaultConditions:
+    - attr: users.age
+      op: ">"
+      val: 10
+      mode: sometimes`))
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,29 @@
+package sqlcomposer
+
+import "strings"
+
+// Dialect of the database, conditions are rendered in the syntax of it
+type Dialect string
+
+const (
+	MySQL      Dialect = "mysql"
+	PostgreSQL         = "postgres"
+	SQLite             = "sqlite3"
+)
+
+// Dialect of the sql driver name, such as mysql, pgx and sqlite3, empty if unknown
+func DialectOf(driverName string) Dialect {
+	name := strings.ToLower(driverName)
+
+	switch {
+	case strings.Contains(name, "mysql"):
+		return MySQL
+	case strings.Contains(name, "postgres"), strings.HasPrefix(name, "pgx"), strings.HasPrefix(name, "pq"),
+		strings.HasPrefix(name, "cockroach"):
+		return PostgreSQL
+	case strings.Contains(name, "sqlite"):
+		return SQLite
+	}
+
+	return ""
+}
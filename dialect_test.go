@@ -0,0 +1,46 @@
+package sqlcomposer
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDialectOf(t *testing.T) {
+	assert.Equal(t, MySQL, DialectOf("mysql"))
+	assert.Equal(t, MySQL, DialectOf("nrmysql"))
+	assert.Equal(t, Dialect(PostgreSQL), DialectOf("postgres"))
+	assert.Equal(t, Dialect(PostgreSQL), DialectOf("pgx"))
+	assert.Equal(t, Dialect(PostgreSQL), DialectOf("cloudsqlpostgres"))
+	assert.Equal(t, Dialect(SQLite), DialectOf("sqlite3"))
+	assert.Equal(t, Dialect(""), DialectOf("oracle"))
+}
+
+func TestSqlBuilder_DefaultDialect(t *testing.T) {
+	sb, err := NewSqlBuilder(nil, []byte(`
+composition:
+  attributes:
+    products.labels:
+      storage: json
+  subject:
+    list: "SELECT products.id FROM products %where"`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the builder without a known driver renders as the package level conditions
+	assert.Equal(t, MySQL, sb.Dialect)
+
+	err = sb.AddFilters([]Filter{
+		{Val: []string{"red"}, Op: HasAny, Attr: "products.labels"},
+		{Val: 1, Op: NullSafeEqual, Attr: "products.weight"},
+		{Val: "x", Op: Equal, Attr: "products.meta->color"},
+	}, AND)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "(JSON_OVERLAPS(products.labels, :products_labels) AND products.weight <=> :products_weight AND "+
+		"JSON_UNQUOTE(JSON_EXTRACT(products.meta, '$.color')) = :products_meta_color)", sb.Conditions.Clause)
+}
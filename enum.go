@@ -0,0 +1,197 @@
+package sqlcomposer
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// RowConverter is the expander convert the result rows, such as label the enum values
+type RowConverter interface {
+	Expander
+	ConvertRow(row *map[string]interface{})
+}
+
+// EnumExpander rewrite the labels of filter value to the values stored in Attr
+//
+//	filterPipelines:
+//	  status:
+//	    type: enum
+//	    params:
+//	      - name: attr
+//	        value: orders.status
+//	      - name: field
+//	        value: status
+//	      - name: values
+//	        value:
+//	          paid: 4
+//	          shipped: [5, 6]
+//
+// Label of multiple values rewrite = to in and <> to not_in, the Field of result rows is converted back to the
+// label, Field is the column name of Attr by default
+type EnumExpander struct {
+	Attr   string
+	Field  string
+	Values map[string][]interface{}
+}
+
+// Expand the enum in the syntax of MySQL, use ExpandContext for the dialect of builder
+func (e *EnumExpander) Expand(origFilter Filter) (ConditionStmt, error) {
+	return e.expand(ConditionBuilder{Dialect: MySQL}, origFilter)
+}
+
+func (e *EnumExpander) ExpandContext(ec ExpansionContext, origFilter Filter) (ConditionStmt, error) {
+	return e.expand(ec.ConditionBuilder(), origFilter)
+}
+
+func (e *EnumExpander) expand(cb ConditionBuilder, origFilter Filter) (ConditionStmt, error) {
+	group, err := e.Rewrite(origFilter)
+
+	if err != nil {
+		return ConditionStmt{}, err
+	}
+
+	var filters []Filter
+	for _, f := range group.Filters {
+		filters = append(filters, *f)
+	}
+
+	return cb.WhereAnd(&filters)
+}
+
+// Implement targeted rewriter, the filters are emitted to Attr
+func (e *EnumExpander) RewriteTargets() []string {
+	return []string{e.Attr}
+}
+
+func (e *EnumExpander) Rewrite(origFilter Filter) (FilterGroup, error) {
+	var labels []interface{}
+
+	rv := reflect.ValueOf(origFilter.Val)
+	if rv.Kind() == reflect.Slice {
+		for i := 0; i < rv.Len(); i++ {
+			labels = append(labels, rv.Index(i).Interface())
+		}
+	} else {
+		labels = append(labels, origFilter.Val)
+	}
+
+	var vals []interface{}
+	multiple := false
+
+	for _, l := range labels {
+		v, ok := e.Values[fmt.Sprint(l)]
+
+		if !ok {
+			return FilterGroup{}, fmt.Errorf("%s enum label %v not exists", origFilter.Attr, l)
+		}
+
+		if len(v) > 1 {
+			multiple = true
+		}
+
+		vals = append(vals, v...)
+	}
+
+	f := &Filter{Attr: e.Attr, Op: origFilter.Op, Val: vals}
+
+	switch origFilter.Op {
+	case Equal:
+		if multiple {
+			f.Op = In
+		} else {
+			f.Val = vals[0]
+		}
+	case NotEqual:
+		if multiple {
+			f.Op = NotIn
+		} else {
+			f.Val = vals[0]
+		}
+	case In, NotIn:
+	case Between, NotBetween:
+		if multiple || len(vals) != 2 {
+			return FilterGroup{}, fmt.Errorf("%s enum %s need two labels of single value", origFilter.Attr, origFilter.Op)
+		}
+	default:
+		if multiple || len(vals) != 1 {
+			return FilterGroup{}, fmt.Errorf("%s enum %s need a label of single value", origFilter.Attr, origFilter.Op)
+		}
+		f.Val = vals[0]
+	}
+
+	return FilterGroup{LogicOp: AND, Filters: []*Filter{f}}, nil
+}
+
+// Convert the values of Field to the labels
+func (e *EnumExpander) ConvertRow(row *map[string]interface{}) {
+	val, ok := (*row)[e.field()]
+
+	if !ok || val == nil {
+		return
+	}
+
+	if b, ok := val.([]byte); ok {
+		val = string(b)
+	}
+
+	if l, ok := e.label(fmt.Sprint(val)); ok {
+		(*row)[e.field()] = l
+	}
+}
+
+func (e *EnumExpander) field() string {
+	if e.Field != "" {
+		return e.Field
+	}
+
+	parts := strings.Split(e.Attr, ".")
+	return parts[len(parts)-1]
+}
+
+// Label of the value, labels are searched in order so that the result is stable
+func (e *EnumExpander) label(val string) (string, bool) {
+	var labels []string
+	for l := range e.Values {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+
+	for _, l := range labels {
+		for _, v := range e.Values[l] {
+			if fmt.Sprint(v) == val {
+				return l, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Enum values of the yaml param value, nil if the mapping is invalid
+func enumValuesOf(v interface{}) map[string][]interface{} {
+	m, ok := v.(map[interface{}]interface{})
+
+	if !ok || len(m) == 0 {
+		return nil
+	}
+
+	values := make(map[string][]interface{}, len(m))
+
+	for l, val := range m {
+		switch vs := val.(type) {
+		case nil:
+			return nil
+		case []interface{}:
+			if len(vs) == 0 {
+				return nil
+			}
+			values[fmt.Sprint(l)] = vs
+		default:
+			values[fmt.Sprint(l)] = []interface{}{vs}
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,162 @@
+package sqlcomposer
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEnumExpander(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  filterPipelines:
+    status:
+      type: enum
+      params:
+        - name: attr
+          value: tickets.status
+        - name: values
+          value:
+            pending: 1
+            paid: 4
+            shipped: [5, 6]
+  fields:
+    base:
+      - name: id
+        expr: tickets.id
+      - name: status
+        expr: tickets.status
+  subject:
+    list: "SELECT %fields.base FROM tickets %where ORDER BY tickets.id"`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		db.MustExec("CREATE TABLE tickets (id integer, status integer)")
+		defer db.MustExec("DROP TABLE tickets")
+
+		db.MustExec("INSERT INTO tickets (id, status) VALUES (1, 1), (2, 4), (3, 5), (4, 6), (5, 9)")
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: "shipped", Op: Equal, Attr: "status"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT tickets.id AS id, tickets.status AS status FROM tickets "+
+			"WHERE ((tickets.status IN(?, ?))) ORDER BY tickets.id", q)
+		assert.Equal(t, []interface{}{5, 6}, a)
+
+		rows, err := db.Queryx(q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var statuses []interface{}
+		for rows.Next() {
+			row := map[string]interface{}{}
+
+			if err := rows.MapScan(row); err != nil {
+				t.Fatal(err)
+			}
+
+			sb.RowConvert(&row)
+			statuses = append(statuses, row["status"])
+		}
+
+		assert.Equal(t, []interface{}{"shipped", "shipped"}, statuses)
+
+		sb.Reset()
+		err = sb.AddFilters([]Filter{
+			{Val: []string{"pending", "paid"}, Op: NotIn, Attr: "status"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err = sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []int
+		err = db.Select(&ids, "SELECT id FROM ("+q+") t", a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []int{3, 4, 5}, ids)
+
+		row := map[string]interface{}{"status": int64(9)}
+		sb.RowConvert(&row)
+		assert.Equal(t, int64(9), row["status"])
+
+		sb.Reset()
+		err = sb.AddFilters([]Filter{
+			{Val: "shipped", Op: Greater, Attr: "status"},
+		}, AND)
+		assert.Error(t, err)
+
+		sb.Reset()
+		err = sb.AddFilters([]Filter{
+			{Val: "lost", Op: Equal, Attr: "status"},
+		}, AND)
+		assert.Error(t, err)
+	})
+}
+
+func TestSqlBuilder_SubjectRowConvert(t *testing.T) {
+	sb, err := NewSqlBuilder(nil, []byte(`
+composition:
+  subject:
+    other: "SELECT tickets.status FROM tickets %where"
+    list:
+      sql: "SELECT tickets.status FROM tickets %where"
+      filterPipelines:
+        status:
+          type: enum
+          params:
+            - name: attr
+              value: tickets.status
+            - name: values
+              value:
+                paid: 4`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := map[string]interface{}{"status": int64(4)}
+	sb.RowConvertSubject("list", &row)
+	assert.Equal(t, "paid", row["status"])
+
+	// the enum of list does not label the rows of others
+	for _, key := range []string{"other", "unknown"} {
+		row = map[string]interface{}{"status": int64(4)}
+		sb.RowConvertSubject(key, &row)
+		assert.Equal(t, int64(4), row["status"])
+	}
+
+	row = map[string]interface{}{"status": int64(4)}
+	sb.RowConvert(&row)
+	assert.Equal(t, int64(4), row["status"])
+}
@@ -0,0 +1,92 @@
+package sqlcomposer
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+type driverNamer interface {
+	DriverName() string
+}
+
+// Build the subject for the queryer or execer, bind vars follow the driver of it when it is known, such as
+// *sqlx.DB and *sqlx.Tx, otherwise the driver of builder DB
+func (sc *SqlBuilder) rebindFor(e interface{}, key string) (string, []interface{}, error) {
+	if dn, ok := e.(driverNamer); ok {
+		return sc.rebind(key, sqlx.BindType(dn.DriverName()))
+	}
+
+	return sc.Rebind(key)
+}
+
+// Query the subject with any queryer, such as *sqlx.DB, *sqlx.Tx and *sqlx.Conn
+func (sc *SqlBuilder) QueryxContext(ctx context.Context, q sqlx.QueryerContext, key string) (*sqlx.Rows, error) {
+	query, args, err := sc.rebindFor(q, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return q.QueryxContext(ctx, query, args...)
+}
+
+// Query the subject and scan rows to dest slice
+func (sc *SqlBuilder) SelectContext(ctx context.Context, q sqlx.QueryerContext, dest interface{}, key string) error {
+	query, args, err := sc.rebindFor(q, key)
+
+	if err != nil {
+		return err
+	}
+
+	return sqlx.SelectContext(ctx, q, dest, query, args...)
+}
+
+// Query the subject and scan one row to dest
+func (sc *SqlBuilder) GetContext(ctx context.Context, q sqlx.QueryerContext, dest interface{}, key string) error {
+	query, args, err := sc.rebindFor(q, key)
+
+	if err != nil {
+		return err
+	}
+
+	return sqlx.GetContext(ctx, q, dest, query, args...)
+}
+
+// Execute the subject with any execer, for the mutation subjects such as UPDATE and DELETE
+func (sc *SqlBuilder) ExecContext(ctx context.Context, e sqlx.ExecerContext, key string) (sql.Result, error) {
+	query, args, err := sc.rebindFor(e, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return e.ExecContext(ctx, query, args...)
+}
+
+// Run fn in a transaction, the transaction is committed when fn returns nil, and rolled back when fn returns error
+// or panics. Subjects run with the tx see a consistent snapshot, such as the list and total of a page
+func WithTx(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions, fn func(tx *sqlx.Tx) error) (err error) {
+	tx, err := db.BeginTxx(ctx, opts)
+
+	if err != nil {
+		return errors.Wrap(err, "begin transaction failure")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		if re := tx.Rollback(); re != nil {
+			return errors.Wrapf(err, "rollback failure: %s", re)
+		}
+		return err
+	}
+
+	return errors.Wrap(tx.Commit(), "commit transaction failure")
+}
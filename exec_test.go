@@ -0,0 +1,119 @@
+package sqlcomposer
+
+import (
+	"context"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWithTx(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  fields:
+    base:
+      - name: name
+        expr: users.name
+      - name: age
+        expr: users.age
+  subject:
+    list: "SELECT %fields.base FROM users %where ORDER BY users.uid"
+    total: "SELECT count(*) FROM users %where"
+    grow: "UPDATE users SET age = age + 1 %where"`
+
+	type user struct {
+		Name string `db:"name"`
+		Age  int64  `db:"age"`
+	}
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		ctx := context.Background()
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: 24, Op: Equal, Attr: "users.age"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var (
+			list  []user
+			total int64
+		)
+
+		err = WithTx(ctx, db, nil, func(tx *sqlx.Tx) error {
+			if err := sb.SelectContext(ctx, tx, &list, "list"); err != nil {
+				return err
+			}
+
+			return sb.GetContext(ctx, tx, &total, "total")
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []user{{Name: "Barry", Age: 24}, {Name: "Zoe", Age: 24}}, list)
+		assert.Equal(t, int64(2), total)
+
+		// rollback on error
+		err = WithTx(ctx, db, nil, func(tx *sqlx.Tx) error {
+			if _, err := sb.ExecContext(ctx, tx, "grow"); err != nil {
+				return err
+			}
+
+			return errors.New("abort")
+		})
+
+		assert.EqualError(t, err, "abort")
+
+		err = sb.GetContext(ctx, db, &total, "total")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, int64(2), total)
+
+		err = WithTx(ctx, db, nil, func(tx *sqlx.Tx) error {
+			res, err := sb.ExecContext(ctx, tx, "grow")
+
+			if err != nil {
+				return err
+			}
+
+			affected, _ := res.RowsAffected()
+			assert.Equal(t, int64(2), affected)
+
+			return nil
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rows, err := sb.QueryxContext(ctx, db, "total")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, true, rows.Next())
+		assert.NoError(t, rows.Scan(&total))
+		assert.Equal(t, int64(0), total)
+		_ = rows.Close()
+	})
+}
@@ -0,0 +1,412 @@
+package sqlcomposer
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+type FulltextMode string
+
+const (
+	// LIKE '%x%' over the fields, no fulltext index required
+	FulltextLike FulltextMode = "like"
+	// MATCH(fields) AGAINST(terms IN BOOLEAN MODE)
+	FulltextMySQL = "mysql"
+	// to_tsvector(fields) @@ plainto_tsquery(terms)
+	FulltextPostgres = "postgres"
+	// fields MATCH terms of FTS5 table
+	FulltextSqlite = "sqlite"
+	// Every term matches one of the fields at least with the operator of filter, AND of ORs
+	FulltextTerms = "terms"
+)
+
+func (m FulltextMode) valid() bool {
+	switch m {
+	case "", FulltextLike, FulltextMySQL, FulltextPostgres, FulltextSqlite, FulltextTerms:
+		return true
+	}
+
+	return false
+}
+
+// FulltextSearchExpander search the filter value in the fields, the search terms are matched by the fulltext
+// index of database with the mode other than like
+//
+//	filterPipelines:
+//	  keyword:
+//	    type: fulltext
+//	    params:
+//	      - name: fields
+//	        value: [products.name^2, products.description]
+//	      - name: mode
+//	        value: mysql
+//	      - name: relevance
+//	        value: relevance
+//
+// Relevance is the field name of the relevance score, it render to %fields.keyword token for ordering, and
+// 0 AS relevance when the filter of pipeline is absent. Weights of fields, such as products.name^2, apply to the
+// relevance of like and terms modes, the weight of field is 1 when not declared
+type FulltextSearchExpander struct {
+	Fields    []string
+	Mode      FulltextMode
+	Relevance string
+	Weights   map[string]float64
+}
+
+// Expand the search in the syntax of MySQL, use ExpandContext for the dialect of builder
+func (e *FulltextSearchExpander) Expand(origFilter Filter) (ConditionStmt, error) {
+	return e.expand(ConditionBuilder{Dialect: MySQL}, origFilter)
+}
+
+func (e *FulltextSearchExpander) ExpandContext(ec ExpansionContext, origFilter Filter) (ConditionStmt, error) {
+	return e.expand(ec.ConditionBuilder(), origFilter)
+}
+
+func (e *FulltextSearchExpander) expand(cb ConditionBuilder, origFilter Filter) (ConditionStmt, error) {
+	if e.Mode == "" || e.Mode == FulltextLike {
+		var filters []Filter
+		filters = []Filter{}
+
+		for _, field := range e.Fields {
+			filters = append(filters, Filter{
+				Attr: field,
+				Op:   origFilter.Op,
+				Val:  origFilter.Val,
+			})
+		}
+
+		return cb.WhereOr(&filters)
+	}
+
+	terms, err := fulltextTerms(origFilter)
+
+	if err != nil {
+		return ConditionStmt{}, err
+	}
+
+	name := strings.Replace(origFilter.Attr, ".", "_", -1)
+	arg := map[string]interface{}{}
+	var clause string
+
+	switch e.Mode {
+	case FulltextTerms:
+		if err = termsOperatorSupported(origFilter.Op); err != nil {
+			return ConditionStmt{}, err
+		}
+
+		var clauses []string
+		for _, t := range terms {
+			var matches []string
+			for _, field := range e.Fields {
+				stmt, err := cb.WhereAnd(&[]Filter{{Attr: field, Op: origFilter.Op, Val: t.Text}})
+
+				if err != nil {
+					return stmt, err
+				}
+
+				stmt = rebaseArgs(stmt, arg)
+				for k, v := range stmt.Arg {
+					arg[k] = v
+				}
+
+				// the field of NULL does not contain the excluded term, rather than makes the NOT unknown
+				if t.Exclude {
+					matches = append(matches, fmt.Sprintf("COALESCE(%s, FALSE)", stmt.Clause))
+				} else {
+					matches = append(matches, stmt.Clause)
+				}
+			}
+
+			if t.Exclude {
+				clauses = append(clauses, fmt.Sprintf("NOT (%s)", strings.Join(matches, " OR ")))
+			} else {
+				clauses = append(clauses, fmt.Sprintf("(%s)", strings.Join(matches, " OR ")))
+			}
+		}
+
+		clause = strings.Join(clauses, " AND ")
+	case FulltextMySQL:
+		arg[name] = mysqlBooleanQuery(terms)
+		clause = fmt.Sprintf("MATCH(%s) AGAINST(:%s IN BOOLEAN MODE)", strings.Join(e.Fields, ", "), name)
+	case FulltextPostgres:
+		var included, excluded []string
+		for _, t := range terms {
+			if t.Exclude {
+				excluded = append(excluded, t.Text)
+			} else {
+				included = append(included, t.Text)
+			}
+		}
+
+		arg[name] = strings.Join(included, " ")
+		clauses := []string{fmt.Sprintf("%s @@ plainto_tsquery(:%s)", e.tsvector(), name)}
+
+		for i, t := range excluded {
+			key := fmt.Sprintf("%s_not_%d", name, i)
+			arg[key] = t
+			clauses = append(clauses, fmt.Sprintf("NOT %s @@ plainto_tsquery(:%s)", e.tsvector(), key))
+		}
+
+		clause = strings.Join(clauses, " AND ")
+	case FulltextSqlite:
+		arg[name] = fts5Query(terms)
+
+		var clauses []string
+		for _, field := range e.Fields {
+			clauses = append(clauses, fmt.Sprintf("%s MATCH :%s", field, name))
+		}
+
+		clause = strings.Join(clauses, " OR ")
+	}
+
+	return ConditionStmt{
+		Clause:      clause,
+		Arg:         arg,
+		ClauseSlice: map[string]string{name: clause},
+	}, nil
+}
+
+// Implement field expander, the relevance score of the search in the syntax of MySQL
+func (e *FulltextSearchExpander) ExpandFields(origFilter Filter) (ConditionStmt, error) {
+	return e.expandFields(ConditionBuilder{Dialect: MySQL}, origFilter)
+}
+
+// Implement context field expander, the relevance score of the search in the syntax of builder dialect
+func (e *FulltextSearchExpander) ExpandFieldsContext(ec ExpansionContext, origFilter Filter) (ConditionStmt, error) {
+	return e.expandFields(ec.ConditionBuilder(), origFilter)
+}
+
+func (e *FulltextSearchExpander) expandFields(cb ConditionBuilder, origFilter Filter) (ConditionStmt, error) {
+	if e.Relevance == "" {
+		return ConditionStmt{}, nil
+	}
+
+	var expr string
+	arg := map[string]interface{}{}
+	name := strings.Replace(origFilter.Attr, ".", "_", -1)
+
+	switch e.Mode {
+	case "", FulltextLike:
+		// weights of the fields matched
+		var err error
+		if expr, err = e.weightedScore(cb, origFilter.Op, []interface{}{origFilter.Val}, arg); err != nil {
+			return ConditionStmt{}, err
+		}
+	case FulltextTerms:
+		terms, err := fulltextTerms(origFilter)
+
+		if err != nil {
+			return ConditionStmt{}, err
+		}
+
+		var vals []interface{}
+		for _, t := range terms {
+			if !t.Exclude {
+				vals = append(vals, t.Text)
+			}
+		}
+
+		if expr, err = e.weightedScore(cb, origFilter.Op, vals, arg); err != nil {
+			return ConditionStmt{}, err
+		}
+	case FulltextMySQL, FulltextPostgres:
+		terms, err := fulltextTerms(origFilter)
+
+		if err != nil {
+			return ConditionStmt{}, err
+		}
+
+		if e.Mode == FulltextMySQL {
+			arg[name] = mysqlBooleanQuery(terms)
+			expr = fmt.Sprintf("MATCH(%s) AGAINST(:%s IN BOOLEAN MODE)", strings.Join(e.Fields, ", "), name)
+		} else {
+			var included []string
+			for _, t := range terms {
+				if !t.Exclude {
+					included = append(included, t.Text)
+				}
+			}
+
+			arg[name] = strings.Join(included, " ")
+			expr = fmt.Sprintf("ts_rank(%s, plainto_tsquery(:%s))", e.tsvector(), name)
+		}
+	case FulltextSqlite:
+		// bm25 is smaller for the better match, the first field must be the FTS5 table
+		expr = fmt.Sprintf("-bm25(%s)", e.Fields[0])
+	}
+
+	return ConditionStmt{
+		Clause: fmt.Sprintf("%s AS %s", expr, e.Relevance),
+		Arg:    arg,
+	}, nil
+}
+
+// Implement field expander
+func (e *FulltextSearchExpander) DefaultFields() string {
+	if e.Relevance == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("0 AS %s", e.Relevance)
+}
+
+// Sum of the weights of fields matched every value, args are put to arg
+func (e *FulltextSearchExpander) weightedScore(cb ConditionBuilder, op Operator, vals []interface{}, arg map[string]interface{}) (string, error) {
+	var cases []string
+
+	for _, val := range vals {
+		for _, field := range e.Fields {
+			stmt, err := cb.WhereAnd(&[]Filter{{Attr: field, Op: op, Val: val}})
+
+			if err != nil {
+				return "", err
+			}
+
+			stmt = rebaseArgs(stmt, arg)
+			for k, v := range stmt.Arg {
+				arg[k] = v
+			}
+
+			w, ok := e.Weights[field]
+			if !ok {
+				w = 1
+			}
+
+			cases = append(cases, fmt.Sprintf("CASE WHEN %s THEN %g ELSE 0 END", stmt.Clause, w))
+		}
+	}
+
+	return fmt.Sprintf("(%s)", strings.Join(cases, " + ")), nil
+}
+
+// Operators compare the term to field in terms mode
+func termsOperatorSupported(op Operator) error {
+	switch op {
+	case Equal, Contains, StartsWith, EndsWith:
+		return nil
+	}
+
+	return fmt.Errorf("operator %s not supported by terms search", op)
+}
+
+func (e *FulltextSearchExpander) tsvector() string {
+	if len(e.Fields) == 1 {
+		return fmt.Sprintf("to_tsvector(%s)", e.Fields[0])
+	}
+
+	return fmt.Sprintf("to_tsvector(concat_ws(' ', %s))", strings.Join(e.Fields, ", "))
+}
+
+// Search terms of the filter value, at least one term not excluded is required
+func fulltextTerms(f Filter) ([]searchTerm, error) {
+	s, ok := f.Val.(string)
+
+	if !ok {
+		return nil, errors.New("fulltext search value must be string type")
+	}
+
+	terms := tokenizeSearchTerms(s)
+
+	for _, t := range terms {
+		if !t.Exclude {
+			return terms, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s search terms are empty", f.Attr)
+}
+
+type searchTerm struct {
+	Text    string
+	Phrase  bool
+	Exclude bool
+}
+
+// Split the search string to terms by spaces, "quoted words" is a phrase, and -term is excluded
+func tokenizeSearchTerms(s string) []searchTerm {
+	var terms []searchTerm
+	rs := []rune(s)
+
+	for i := 0; i < len(rs); {
+		if rs[i] == ' ' || rs[i] == '\t' || rs[i] == '\n' {
+			i++
+			continue
+		}
+
+		t := searchTerm{}
+
+		if rs[i] == '-' {
+			t.Exclude = true
+			i++
+		}
+
+		var end int
+		if i < len(rs) && rs[i] == '"' {
+			t.Phrase = true
+			i++
+			for end = i; end < len(rs) && rs[end] != '"'; end++ {
+			}
+			t.Text = strings.TrimSpace(string(rs[i:end]))
+			end++
+		} else {
+			for end = i; end < len(rs) && rs[end] != ' ' && rs[end] != '\t' && rs[end] != '\n'; end++ {
+			}
+			t.Text = string(rs[i:end])
+		}
+
+		i = end
+
+		if t.Text != "" {
+			terms = append(terms, t)
+		}
+	}
+
+	return terms
+}
+
+// Terms of MySQL boolean mode, every term is required unless excluded
+func mysqlBooleanQuery(terms []searchTerm) string {
+	var qs []string
+
+	for _, t := range terms {
+		prefix := "+"
+		if t.Exclude {
+			prefix = "-"
+		}
+
+		if t.Phrase {
+			qs = append(qs, fmt.Sprintf(`%s"%s"`, prefix, strings.Replace(t.Text, `"`, "", -1)))
+		} else if text := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`+-<>()~*"@`, r) {
+				return -1
+			}
+			return r
+		}, t.Text); text != "" {
+			qs = append(qs, prefix+text)
+		}
+	}
+
+	return strings.Join(qs, " ")
+}
+
+// Query of FTS5, terms are quoted as strings and excluded terms follow NOT
+func fts5Query(terms []searchTerm) string {
+	var included, excluded []string
+
+	for _, t := range terms {
+		q := `"` + strings.Replace(t.Text, `"`, `""`, -1) + `"`
+		if t.Exclude {
+			excluded = append(excluded, q)
+		} else {
+			included = append(included, q)
+		}
+	}
+
+	q := strings.Join(included, " ")
+	for _, e := range excluded {
+		q += " NOT " + e
+	}
+
+	return q
+}
@@ -0,0 +1,285 @@
+package sqlcomposer
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_tokenizeSearchTerms(t *testing.T) {
+	assert.Equal(t, []searchTerm{
+		{Text: "red"},
+		{Text: "steel bolt", Phrase: true},
+		{Text: "zinc", Exclude: true},
+		{Text: "old stock", Phrase: true, Exclude: true},
+	}, tokenizeSearchTerms(` red  "steel bolt" -zinc -"old stock" "" -`))
+
+	assert.Equal(t, `+red +"steel bolt" -zinc`, mysqlBooleanQuery(tokenizeSearchTerms(`red* "steel bolt" -zinc`)))
+	assert.Equal(t, `"red" "say ""hi""" NOT "zinc"`, fts5Query([]searchTerm{
+		{Text: "red"}, {Text: `say "hi"`, Phrase: true}, {Text: "zinc", Exclude: true},
+	}))
+}
+
+func TestFulltextSearchExpander_Modes(t *testing.T) {
+	f := Filter{Val: `bolt -zinc`, Op: Contains, Attr: "keyword"}
+
+	e := &FulltextSearchExpander{
+		Fields:    []string{"products.name", "products.description"},
+		Mode:      FulltextMySQL,
+		Relevance: "relevance",
+	}
+
+	stmt, err := e.Expand(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "MATCH(products.name, products.description) AGAINST(:keyword IN BOOLEAN MODE)", stmt.Clause)
+	assert.Equal(t, map[string]interface{}{"keyword": "+bolt -zinc"}, stmt.Arg)
+
+	fields, err := e.ExpandFields(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "MATCH(products.name, products.description) AGAINST(:keyword IN BOOLEAN MODE) AS relevance",
+		fields.Clause)
+
+	e.Mode = FulltextPostgres
+	stmt, err = e.Expand(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "to_tsvector(concat_ws(' ', products.name, products.description)) @@ plainto_tsquery(:keyword) AND "+
+		"NOT to_tsvector(concat_ws(' ', products.name, products.description)) @@ plainto_tsquery(:keyword_not_0)",
+		stmt.Clause)
+	assert.Equal(t, map[string]interface{}{"keyword": "bolt", "keyword_not_0": "zinc"}, stmt.Arg)
+
+	e.Mode = FulltextSqlite
+	e.Fields = []string{"products_fts"}
+	stmt, err = e.Expand(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "products_fts MATCH :keyword", stmt.Clause)
+	assert.Equal(t, map[string]interface{}{"keyword": `"bolt" NOT "zinc"`}, stmt.Arg)
+
+	_, err = e.Expand(Filter{Val: "-zinc", Op: Contains, Attr: "keyword"})
+	assert.Error(t, err)
+
+	// fields must be non empty
+	_, err = NewSqlBuilder(nil, []byte(`
+composition:
+  filterPipelines:
+    keyword:
+      type: fulltext
+      params:
+        - name: fields
+          value: []
+        - name: mode
+          value: sqlite
+        - name: relevance
+          value: relevance`))
+	assert.Error(t, err)
+}
+
+func TestFulltextSearchExpander_Relevance(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  filterPipelines:
+    keyword:
+      type: fulltext
+      params:
+        - name: fields
+          value: [users.name, orders.order_no]
+        - name: relevance
+          value: relevance
+  fields:
+    base:
+      - name: name
+        expr: users.name
+  subject:
+    list: "SELECT DISTINCT %fields.base, %fields.keyword FROM users LEFT JOIN orders ON orders.uid = users.uid %where %order_by"`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, _, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT DISTINCT users.name AS name, 0 AS relevance FROM users "+
+			"LEFT JOIN orders ON orders.uid = users.uid", q)
+
+		err = sb.AddFilters([]Filter{
+			{Val: "o", Op: Contains, Attr: "keyword"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sb.OrderBy(&OrderBy{{Name: "relevance", Direction: DESC}, {Name: "name", Direction: ASC}})
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT DISTINCT users.name AS name, "+
+			"(CASE WHEN users.name LIKE ? THEN 1 ELSE 0 END + CASE WHEN orders.order_no LIKE ? THEN 1 ELSE 0 END) AS relevance "+
+			"FROM users LEFT JOIN orders ON orders.uid = users.uid "+
+			"WHERE ((users.name LIKE ? OR orders.order_no LIKE ?)) ORDER BY relevance DESC, name ASC", q)
+		assert.Equal(t, []interface{}{"%o%", "%o%", "%o%", "%o%"}, a)
+
+		rows, err := db.Queryx(q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer rows.Close()
+
+		var res []map[string]interface{}
+		for rows.Next() {
+			row := make(map[string]interface{})
+			if err = rows.MapScan(row); err != nil {
+				t.Fatal(err)
+			}
+			res = append(res, row)
+		}
+
+		assert.Equal(t, []map[string]interface{}{
+			{"name": "Scott", "relevance": int64(1)},
+			{"name": "Zoe", "relevance": int64(1)},
+		}, res)
+	})
+}
+
+func TestFulltextSearchExpander_Terms(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  filterPipelines:
+    keyword:
+      type: fulltext
+      params:
+        - name: fields
+          value: [users.name^2, orders.order_no]
+        - name: mode
+          value: terms
+        - name: relevance
+          value: relevance
+  fields:
+    base:
+      - name: name
+        expr: users.name
+  subject:
+    list: "SELECT %fields.base, %fields.keyword FROM users LEFT JOIN orders ON orders.uid = users.uid %where %order_by"`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: `00 "r" -"002"`, Op: Contains, Attr: "keyword"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sb.OrderBy(&OrderBy{{Name: "relevance", Direction: DESC}, {Name: "name", Direction: ASC}})
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name, "+
+			"(CASE WHEN users.name LIKE ? THEN 2 ELSE 0 END + CASE WHEN orders.order_no LIKE ? THEN 1 ELSE 0 END + "+
+			"CASE WHEN users.name LIKE ? THEN 2 ELSE 0 END + CASE WHEN orders.order_no LIKE ? THEN 1 ELSE 0 END) AS relevance "+
+			"FROM users LEFT JOIN orders ON orders.uid = users.uid "+
+			"WHERE (((users.name LIKE ? OR orders.order_no LIKE ?) AND (users.name LIKE ? OR orders.order_no LIKE ?) AND "+
+			"NOT (COALESCE(users.name LIKE ?, FALSE) OR COALESCE(orders.order_no LIKE ?, FALSE)))) ORDER BY relevance DESC, name ASC", q)
+		assert.Equal(t, []interface{}{"%00%", "%00%", "%r%", "%r%", "%00%", "%00%", "%r%", "%r%", "%002%", "%002%"}, a)
+
+		rows, err := db.Queryx(q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer rows.Close()
+
+		var res []map[string]interface{}
+		for rows.Next() {
+			row := make(map[string]interface{})
+			if err = rows.MapScan(row); err != nil {
+				t.Fatal(err)
+			}
+			res = append(res, row)
+		}
+
+		assert.Equal(t, []map[string]interface{}{
+			{"name": "Barry", "relevance": int64(3)},
+		}, res)
+
+		// the user without orders does not contain the excluded term
+		db.MustExec("INSERT INTO users (uid, name, age) VALUES (4, 'Harry', 30)")
+
+		sb.Reset()
+		err = sb.AddFilters([]Filter{
+			{Val: `rr -"002"`, Op: Contains, Attr: "keyword"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err = sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		if err = db.Select(&names, "SELECT name FROM ("+q+") t", a...); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"Barry", "Harry"}, names)
+
+		sb.Reset()
+		err = sb.AddFilters([]Filter{
+			{Val: "00", Op: Greater, Attr: "keyword"},
+		}, AND)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,213 @@
+package sqlcomposer
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Kilometers of one degree latitude
+const kmPerDegree = 111.045
+
+// Center and radius in kilometers of the geo filter value
+type GeoRadius struct {
+	Lat    float64
+	Lng    float64
+	Radius float64
+}
+
+// GeoExpander filter the rows within the radius of the point, it expands to a bounding box could use the index
+// of columns, and the exact distance predicate of the dialect
+//
+//	filterPipelines:
+//	  near:
+//	    type: geo
+//	    params:
+//	      - name: lat
+//	        value: shops.lat
+//	      - name: lng
+//	        value: shops.lng
+//	      - name: distance
+//	        value: distance
+//
+// The filter value is GeoRadius or map of lat, lng and radius. Haversine distance is used by MySQL and PostgreSQL,
+// SQLite uses the equirectangular approximation since it has no trigonometric functions. Distance is the
+// field name of distance in kilometers render to %fields.near, it is squared on SQLite as sqrt is absent.
+// The builder expand with its dialect, Dialect is used when the expander is called directly, MySQL if empty
+type GeoExpander struct {
+	Lat      string
+	Lng      string
+	Distance string
+	Dialect  Dialect
+}
+
+func (e *GeoExpander) Expand(origFilter Filter) (ConditionStmt, error) {
+	g, err := geoRadiusOf(origFilter.Val)
+
+	if err != nil {
+		return ConditionStmt{}, errors.Wrapf(err, "%s geo value invalid", origFilter.Attr)
+	}
+
+	name := strings.Replace(origFilter.Attr, ".", "_", -1)
+	dlat := g.Radius / kmPerDegree
+
+	arg := map[string]interface{}{
+		name + "_lat_min": g.Lat - dlat,
+		name + "_lat_max": g.Lat + dlat,
+	}
+
+	clauses := []string{
+		fmt.Sprintf("%s BETWEEN :%s_lat_min AND :%s_lat_max", e.Lat, name, name),
+	}
+
+	// longitude range is unbounded near the poles or crossing the antimeridian
+	if cos := math.Cos(g.Lat * math.Pi / 180); math.Abs(g.Lat)+dlat < 90 && cos > 0 {
+		dlng := dlat / cos
+
+		if g.Lng-dlng >= -180 && g.Lng+dlng <= 180 {
+			arg[name+"_lng_min"] = g.Lng - dlng
+			arg[name+"_lng_max"] = g.Lng + dlng
+			clauses = append(clauses, fmt.Sprintf("%s BETWEEN :%s_lng_min AND :%s_lng_max", e.Lng, name, name))
+		}
+	}
+
+	expr, limit := e.distance(name, g, arg)
+	clauses = append(clauses, fmt.Sprintf("%s <= :%s", expr, limit))
+
+	clause := strings.Join(clauses, " AND ")
+
+	return ConditionStmt{
+		Clause:      clause,
+		Arg:         arg,
+		ClauseSlice: map[string]string{name: clause},
+	}, nil
+}
+
+// Implement context expander, the distance predicate follows the dialect of context
+func (e *GeoExpander) ExpandContext(ec ExpansionContext, origFilter Filter) (ConditionStmt, error) {
+	return e.withDialect(ec.Dialect).Expand(origFilter)
+}
+
+// Implement context field expander, the distance field follows the dialect of context
+func (e *GeoExpander) ExpandFieldsContext(ec ExpansionContext, origFilter Filter) (ConditionStmt, error) {
+	return e.withDialect(ec.Dialect).ExpandFields(origFilter)
+}
+
+func (e *GeoExpander) withDialect(d Dialect) *GeoExpander {
+	c := *e
+	c.Dialect = d
+
+	return &c
+}
+
+// Implement field expander
+func (e *GeoExpander) ExpandFields(origFilter Filter) (ConditionStmt, error) {
+	if e.Distance == "" {
+		return ConditionStmt{}, nil
+	}
+
+	g, err := geoRadiusOf(origFilter.Val)
+
+	if err != nil {
+		return ConditionStmt{}, errors.Wrapf(err, "%s geo value invalid", origFilter.Attr)
+	}
+
+	arg := map[string]interface{}{}
+	expr, _ := e.distance(strings.Replace(origFilter.Attr, ".", "_", -1), g, arg)
+
+	return ConditionStmt{
+		Clause: fmt.Sprintf("%s AS %s", expr, e.Distance),
+		Arg:    arg,
+	}, nil
+}
+
+// Implement field expander
+func (e *GeoExpander) DefaultFields() string {
+	if e.Distance == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("NULL AS %s", e.Distance)
+}
+
+// Distance expression of the dialect and the arg name of its upper limit, args are put to arg
+func (e *GeoExpander) distance(name string, g GeoRadius, arg map[string]interface{}) (expr string, limit string) {
+	arg[name+"_lat"] = g.Lat
+	arg[name+"_lng"] = g.Lng
+
+	if e.Dialect == SQLite {
+		// squared distance of equirectangular approximation, cos of latitude is computed here
+		cos := math.Cos(g.Lat * math.Pi / 180)
+		arg[name+"_cos2"] = cos * cos * kmPerDegree * kmPerDegree
+		arg[name+"_lat_km2"] = kmPerDegree * kmPerDegree
+		arg[name+"_radius2"] = g.Radius * g.Radius
+
+		return fmt.Sprintf("(%s - :%s_lat) * (%s - :%s_lat) * :%s_lat_km2 + (%s - :%s_lng) * (%s - :%s_lng) * :%s_cos2",
+			e.Lat, name, e.Lat, name, name, e.Lng, name, e.Lng, name, name), name + "_radius2"
+	}
+
+	arg[name+"_radius"] = g.Radius
+
+	return fmt.Sprintf("6371 * 2 * ASIN(SQRT(POWER(SIN(RADIANS(%s - :%s_lat) / 2), 2) + "+
+		"COS(RADIANS(:%s_lat)) * COS(RADIANS(%s)) * POWER(SIN(RADIANS(%s - :%s_lng) / 2), 2)))",
+		e.Lat, name, name, e.Lat, e.Lng, name), name + "_radius"
+}
+
+func geoRadiusOf(v interface{}) (GeoRadius, error) {
+	var g GeoRadius
+	var m map[string]interface{}
+
+	switch val := v.(type) {
+	case GeoRadius:
+		g = val
+	case *GeoRadius:
+		if val == nil {
+			return g, errors.New("nil geo radius")
+		}
+		g = *val
+	case map[string]interface{}:
+		m = val
+	case map[interface{}]interface{}:
+		m = make(map[string]interface{}, len(val))
+		for k, mv := range val {
+			m[fmt.Sprint(k)] = mv
+		}
+	default:
+		return g, fmt.Errorf("geo value of type %T is not supported", v)
+	}
+
+	if m != nil {
+		for key, f := range map[string]*float64{"lat": &g.Lat, "lng": &g.Lng, "radius": &g.Radius} {
+			n, err := toFloat64(m[key])
+			if err != nil {
+				return g, errors.Wrap(err, key)
+			}
+			*f = n
+		}
+	}
+
+	if g.Lat < -90 || g.Lat > 90 || g.Lng < -180 || g.Lng > 180 || g.Radius <= 0 {
+		return g, fmt.Errorf("geo value %v is out of range", g)
+	}
+
+	return g, nil
+}
+
+func toFloat64(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case float32:
+		return float64(n), nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case string:
+		return strconv.ParseFloat(n, 64)
+	}
+
+	return 0, fmt.Errorf("%v is not a number", v)
+}
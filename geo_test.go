@@ -0,0 +1,138 @@
+package sqlcomposer
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGeoExpander(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  filterPipelines:
+    near:
+      type: geo
+      params:
+        - name: lat
+          value: shops.lat
+        - name: lng
+          value: shops.lng
+        - name: distance
+          value: distance
+  fields:
+    base:
+      - name: name
+        expr: shops.name
+  subject:
+    list: "SELECT %fields.base, %fields.near FROM shops %where %order_by"`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		db.MustExec("CREATE TABLE shops (name text, lat float, lng float)")
+		defer db.MustExec("DROP TABLE shops")
+
+		db.MustExec("INSERT INTO shops (name, lat, lng) VALUES ('bund', 31.2400, 121.4900), " +
+			"('jingan', 31.2230, 121.4450), ('pudong airport', 31.1443, 121.8083), ('beijing', 39.9042, 116.4074)")
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, _, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT shops.name AS name, NULL AS distance FROM shops", q)
+
+		err = sb.AddFilters([]Filter{
+			{Val: map[string]interface{}{"lat": 31.2304, "lng": 121.4737, "radius": 10}, Op: Equal, Attr: "near"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sb.OrderBy(&OrderBy{{Name: "distance", Direction: ASC}})
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT shops.name AS name, "+
+			"(shops.lat - ?) * (shops.lat - ?) * ? + (shops.lng - ?) * (shops.lng - ?) * ? AS distance FROM shops "+
+			"WHERE ((shops.lat BETWEEN ? AND ? AND shops.lng BETWEEN ? AND ? AND "+
+			"(shops.lat - ?) * (shops.lat - ?) * ? + (shops.lng - ?) * (shops.lng - ?) * ? <= ?)) ORDER BY distance ASC", q)
+
+		var names []string
+		err = db.Select(&names, "SELECT name FROM ("+q+") t", a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"bund", "jingan"}, names)
+
+		// haversine on mysql
+		e := &GeoExpander{Lat: "shops.lat", Lng: "shops.lng"}
+		stmt, err := e.ExpandContext(ExpansionContext{Context: context.Background(), Dialect: MySQL}, Filter{
+			Val: GeoRadius{Lat: 31.2304, Lng: 121.4737, Radius: 10}, Op: Equal, Attr: "near",
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "shops.lat BETWEEN :near_lat_min AND :near_lat_max AND "+
+			"shops.lng BETWEEN :near_lng_min AND :near_lng_max AND "+
+			"6371 * 2 * ASIN(SQRT(POWER(SIN(RADIANS(shops.lat - :near_lat) / 2), 2) + "+
+			"COS(RADIANS(:near_lat)) * COS(RADIANS(shops.lat)) * POWER(SIN(RADIANS(shops.lng - :near_lng) / 2), 2))) "+
+			"<= :near_radius", stmt.Clause)
+		assert.Equal(t, float64(10), stmt.Arg["near_radius"])
+		assert.Equal(t, Dialect(""), e.Dialect)
+
+		// fields follow the dialect of context or of the expander, without the state of previous expanding
+		e.Distance = "distance"
+		near := Filter{Val: GeoRadius{Lat: 31.2304, Lng: 121.4737, Radius: 10}, Op: Equal, Attr: "near"}
+
+		fields, err := e.ExpandFieldsContext(ExpansionContext{Context: context.Background(), Dialect: SQLite}, near)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.NotContains(t, fields.Clause, "ASIN")
+
+		// the dialect of expander is MySQL by default
+		fields, err = e.ExpandFields(near)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Contains(t, fields.Clause, "6371 * 2 * ASIN(SQRT(")
+
+		fields, err = (&GeoExpander{Lat: "shops.lat", Lng: "shops.lng", Distance: "distance", Dialect: SQLite}).ExpandFields(near)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.NotContains(t, fields.Clause, "ASIN")
+		e.Distance = ""
+
+		_, err = e.Expand(Filter{Val: GeoRadius{Lat: 91, Lng: 0, Radius: 1}, Attr: "near"})
+		assert.Error(t, err)
+
+		_, err = e.Expand(Filter{Val: map[string]interface{}{"lat": 1, "lng": "x", "radius": 1}, Attr: "near"})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,113 @@
+package sqlcomposer
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+var jsonPathSegmentRegexp = regexp.MustCompile(`^\w+(\[\d+])*$`)
+
+// Path in the JSON column, the attr such as orders.meta->channel or orders.meta$.channel
+type jsonPath struct {
+	Column string
+	Path   []string
+}
+
+// Parse the JSON path of attr, false if the attr is not a JSON path
+func parseJSONPath(attr string) (jsonPath, bool) {
+	var column, path string
+
+	if i := strings.Index(attr, "->"); i > 0 {
+		column, path = attr[:i], strings.Replace(attr[i+2:], "->", ".", -1)
+	} else if i := strings.Index(attr, "$."); i > 0 {
+		column, path = attr[:i], attr[i+2:]
+	} else {
+		return jsonPath{}, false
+	}
+
+	segments := strings.Split(strings.TrimSpace(path), ".")
+	for _, s := range segments {
+		if !jsonPathSegmentRegexp.MatchString(s) {
+			return jsonPath{}, false
+		}
+	}
+
+	return jsonPath{Column: strings.TrimSpace(column), Path: segments}, true
+}
+
+// Expression extract the path from column, numeric extraction is cast to number for comparing
+func (p jsonPath) expr(dialect Dialect, numeric bool) string {
+	switch dialect {
+	case PostgreSQL:
+		var e string
+		if len(p.Path) == 1 && !strings.Contains(p.Path[0], "[") {
+			e = fmt.Sprintf("%s->>'%s'", p.Column, p.Path[0])
+		} else {
+			var keys []string
+			for _, s := range p.Path {
+				keys = append(keys, strings.Split(strings.Replace(s, "]", "", -1), "[")...)
+			}
+			e = fmt.Sprintf("%s#>>'{%s}'", p.Column, strings.Join(keys, ","))
+		}
+
+		if numeric {
+			return fmt.Sprintf("CAST(%s AS numeric)", e)
+		}
+		return e
+	case SQLite:
+		// json_extract of SQLite returns the value of JSON type
+		return fmt.Sprintf("json_extract(%s, '$.%s')", p.Column, strings.Join(p.Path, "."))
+	}
+
+	e := fmt.Sprintf("JSON_EXTRACT(%s, '$.%s')", p.Column, strings.Join(p.Path, "."))
+	if numeric {
+		return fmt.Sprintf("CAST(%s AS DECIMAL(65,30))", e)
+	}
+	return fmt.Sprintf("JSON_UNQUOTE(%s)", e)
+}
+
+// Filter value is compared as number, the elements of list values are checked
+func numericFilter(f Filter) bool {
+	switch f.Op {
+	case StartsWith, Contains, EndsWith, IsNull, IsNotNull:
+		return false
+	}
+
+	rv := reflect.ValueOf(f.Val)
+	if rv.Kind() == reflect.Slice {
+		if rv.Len() == 0 {
+			return false
+		}
+		rv = reflect.ValueOf(rv.Index(0).Interface())
+	}
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+// Fields of the group with JSON path expressions translated to the dialect
+func (cb ConditionBuilder) fieldGroup(group SqlCompositionFieldGroup) SqlCompositionFieldGroup {
+	res := make(SqlCompositionFieldGroup, len(group))
+
+	for i, f := range group {
+		if p, ok := parseJSONPath(f.Expr); ok {
+			switch f.Type {
+			case "int", "float", "decimal", "number":
+				f.Expr = p.expr(cb.Dialect, true)
+			default:
+				f.Expr = p.expr(cb.Dialect, false)
+			}
+		}
+		res[i] = f
+	}
+
+	return res
+}
@@ -0,0 +1,123 @@
+package sqlcomposer
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_parseJSONPath(t *testing.T) {
+	p, ok := parseJSONPath("orders.meta->channel")
+	assert.True(t, ok)
+	assert.Equal(t, jsonPath{Column: "orders.meta", Path: []string{"channel"}}, p)
+
+	p, ok = parseJSONPath("orders.meta$.items[0].sku")
+	assert.True(t, ok)
+	assert.Equal(t, jsonPath{Column: "orders.meta", Path: []string{"items[0]", "sku"}}, p)
+
+	_, ok = parseJSONPath("orders.meta->>'$.channel'")
+	assert.False(t, ok)
+
+	_, ok = parseJSONPath("orders.meta")
+	assert.False(t, ok)
+}
+
+func TestConditionBuilder_JSONPath(t *testing.T) {
+	f := &[]Filter{
+		{Val: "app", Op: Equal, Attr: "orders.meta->channel"},
+		{Val: 3, Op: Greater, Attr: "orders.meta$.items[0].qty"},
+	}
+
+	s, err := Conditions(f, AND)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "JSON_UNQUOTE(JSON_EXTRACT(orders.meta, '$.channel')) = :orders_meta_channel AND "+
+		"CAST(JSON_EXTRACT(orders.meta, '$.items[0].qty') AS DECIMAL(65,30)) > :orders_meta_items_0_qty", s.Clause)
+	assert.Equal(t, map[string]interface{}{"orders_meta_channel": "app", "orders_meta_items_0_qty": 3}, s.Arg)
+
+	s, err = ConditionBuilder{Dialect: PostgreSQL}.WhereAnd(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "orders.meta->>'channel' = :orders_meta_channel AND "+
+		"CAST(orders.meta#>>'{items,0,qty}' AS numeric) > :orders_meta_items_0_qty", s.Clause)
+
+	s, err = ConditionBuilder{Dialect: SQLite}.WhereAnd(f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "json_extract(orders.meta, '$.channel') = :orders_meta_channel AND "+
+		"json_extract(orders.meta, '$.items[0].qty') > :orders_meta_items_0_qty", s.Clause)
+}
+
+func TestSqlBuilder_JSONPath(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  fields:
+    base:
+      - name: id
+        expr: events.id
+      - name: channel
+        expr: events.meta->channel
+  subject:
+    list: "SELECT %fields.base FROM events %where{!events_meta_channel} ORDER BY events.id"`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		// json functions need the sqlite_json build tag of go-sqlite3
+		if _, err := db.Exec("SELECT json('[]')"); err != nil {
+			t.Skip("sqlite json functions are not available")
+		}
+
+		db.MustExec("CREATE TABLE events (id integer, meta text)")
+		defer db.MustExec("DROP TABLE events")
+
+		db.MustExec(`INSERT INTO events (id, meta) VALUES (1, '{"channel":"app","amount":12}'), ` +
+			`(2, '{"channel":"web","amount":5}'), (3, '{"channel":"app","amount":3}')`)
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: "app", Op: Equal, Attr: "events.meta->channel"},
+			{Val: 4, Op: Greater, Attr: "events.meta$.amount"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT events.id AS id, json_extract(events.meta, '$.channel') AS channel FROM events "+
+			"WHERE (json_extract(events.meta, '$.amount') > ?) ORDER BY events.id", q)
+
+		var rows []struct {
+			ID      int    `db:"id"`
+			Channel string `db:"channel"`
+		}
+		if err = db.Select(&rows, q, a...); err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Len(t, rows, 2)
+		assert.Equal(t, "app", rows[0].Channel)
+		assert.Equal(t, "web", rows[1].Channel)
+	})
+}
@@ -0,0 +1,219 @@
+package sqlcomposer
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entries of the lookup cache of builder by default
+const DefaultLookupCacheSize = 1024
+
+type lookupCacheEntry struct {
+	ids     []interface{}
+	expires time.Time
+}
+
+// LookupCache cache the ids of lookup queries, expired entries are swept on insert and the entry expires first is
+// evicted when the cache is full. The builder has its own cache shared with its clones, WithLookupCache share the
+// cache between builders
+type LookupCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]lookupCacheEntry
+}
+
+func NewLookupCache(size int) *LookupCache {
+	return &LookupCache{size: size, entries: make(map[string]lookupCacheEntry)}
+}
+
+func (c *LookupCache) get(key string) ([]interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	return entry.ids, true
+}
+
+func (c *LookupCache) set(key string, ids []interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.size <= 0 {
+		return
+	}
+
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+
+	for len(c.entries) >= c.size {
+		var (
+			oldest  string
+			expires time.Time
+		)
+
+		for k, entry := range c.entries {
+			if oldest == "" || entry.expires.Before(expires) {
+				oldest, expires = k, entry.expires
+			}
+		}
+
+		delete(c.entries, oldest)
+	}
+
+	c.entries[key] = lookupCacheEntry{ids: ids, expires: now.Add(ttl)}
+}
+
+// Count of the entries
+func (c *LookupCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.entries)
+}
+
+// LookupExpander resolve the filter value to ids by the lookup query, and rewrite the filter to
+// IN condition of Attr, such as filter by category name on the category_id column
+//
+//	filterPipelines:
+//	  category:
+//	    type: lookup
+//	    params:
+//	      - name: attr
+//	        value: products.category_id
+//	      - name: query
+//	        value: "SELECT id FROM categories %where"
+//	      - name: match
+//	        value: categories.name
+//	      - name: ttl
+//	        value: 5m
+//
+// The filter is applied to Match of the lookup query with its operator, ids are cached for TTL in the lookup cache
+// of expansion context when it is set
+type LookupExpander struct {
+	Attr  string
+	Query string
+	Match string
+	TTL   time.Duration
+}
+
+// Lookup need the database, use ExpandContext instead
+func (e *LookupExpander) Expand(origFilter Filter) (ConditionStmt, error) {
+	return ConditionStmt{}, fmt.Errorf("lookup of %s need the database", e.Attr)
+}
+
+func (e *LookupExpander) ExpandContext(ec ExpansionContext, origFilter Filter) (ConditionStmt, error) {
+	if ec.DB == nil {
+		return e.Expand(origFilter)
+	}
+
+	cb := ec.ConditionBuilder()
+	ids, err := e.lookup(ec.Context, ec.DB, cb, ec.LookupCache, origFilter)
+
+	if err != nil {
+		return ConditionStmt{}, err
+	}
+
+	// no ids matched, the condition never be true
+	if len(ids) == 0 {
+		key := strings.Replace(e.Attr, ".", "_", -1)
+
+		return ConditionStmt{
+			Clause:      "1 = 0",
+			Arg:         map[string]interface{}{},
+			ClauseSlice: map[string]string{key: "1 = 0"},
+		}, nil
+	}
+
+	return cb.WhereAnd(&[]Filter{
+		{Attr: e.Attr, Op: In, Val: ids},
+	})
+}
+
+func (e *LookupExpander) lookup(ctx context.Context, q sqlx.QueryerContext, cb ConditionBuilder, cache *LookupCache,
+	origFilter Filter) ([]interface{}, error) {
+	inner, err := cb.WhereAnd(&[]Filter{
+		{Attr: e.Match, Op: origFilter.Op, Val: origFilter.Val},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	subject, err := tokenReplace(e.Query, map[string]interface{}{
+		"where": inner,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	bindType := sqlx.UNKNOWN
+	if dn, ok := q.(driverNamer); ok {
+		bindType = sqlx.BindType(dn.DriverName())
+	}
+
+	query, args, err := bindNamed(subject, inner.Arg, bindType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%p|%s|%v", q, query, args)
+
+	cached := e.TTL > 0 && cache != nil
+
+	if cached {
+		if ids, ok := cache.get(key); ok {
+			return ids, nil
+		}
+	}
+
+	rows, err := q.QueryxContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "lookup query failure")
+	}
+
+	defer rows.Close()
+
+	ids := make([]interface{}, 0)
+
+	for rows.Next() {
+		var id interface{}
+
+		if err = rows.Scan(&id); err != nil {
+			return nil, errors.Wrap(err, "lookup scan failure")
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "lookup query failure")
+	}
+
+	if cached {
+		cache.set(key, ids, e.TTL)
+	}
+
+	return ids, nil
+}
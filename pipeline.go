@@ -1,48 +1,388 @@
 package sqlcomposer
 
-import "reflect"
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
 
-func GenerateExpander(t string) ExpanderGenerator {
-	switch t {
-	case "fulltext":
-		return func(ps FilterPipelineParams) Expander {
-			paramFields := ps.Get("fields")
-			rv := reflect.ValueOf(paramFields)
+var (
+	generatorsMu sync.RWMutex
+	generators   = map[string]ExpanderGenerator{}
+)
 
-			if rv.Kind() == reflect.Slice {
-				fields := make([]string, rv.Len())
+func init() {
+	_ = RegisterExpanderGenerator("fulltext", func(ps FilterPipelineParams) Expander {
+		paramFields := ps.Get("fields")
+		rv := reflect.ValueOf(paramFields)
 
-				for i := 0; i < rv.Len(); i++ {
-					fields[i] = rv.Index(i).Elem().String()
-				}
+		// the search needs at least one field
+		if rv.Kind() == reflect.Slice && rv.Len() > 0 {
+			fields := make([]string, rv.Len())
+			weights := map[string]float64{}
 
-				return &FulltextSearchExpander{
-					Fields: fields,
+			for i := 0; i < rv.Len(); i++ {
+				// field^2 is the field of weight 2 for ranking
+				ss := strings.SplitN(rv.Index(i).Elem().String(), "^", 2)
+				fields[i] = ss[0]
+
+				if len(ss) == 2 {
+					w, err := strconv.ParseFloat(ss[1], 64)
+					if err != nil {
+						return nil
+					}
+					weights[ss[0]] = w
 				}
 			}
 
+			e := &FulltextSearchExpander{
+				Fields:    fields,
+				Mode:      FulltextMode(ps.GetString("mode")),
+				Relevance: ps.GetString("relevance"),
+				Weights:   weights,
+			}
+
+			if !e.Mode.valid() {
+				return nil
+			}
+
+			return e
+		}
+
+		return nil
+	})
+
+	_ = RegisterExpanderGenerator("subquery", func(ps FilterPipelineParams) Expander {
+		e := &SubqueryExpander{
+			Column: ps.GetString("column"),
+			Query:  ps.GetString("query"),
+			Attr:   ps.GetString("attr"),
+		}
+
+		if e.Column == "" || e.Attr == "" || !strings.Contains(e.Query, "%where") {
 			return nil
 		}
+
+		return e
+	})
+
+	_ = RegisterExpanderGenerator("template", func(ps FilterPipelineParams) Expander {
+		e := &TemplateExpander{SQL: ps.GetString("sql")}
+
+		if e.SQL == "" {
+			return nil
+		}
+
+		if strings.Contains(e.SQL, "{{") {
+			tmpl, err := template.New("sql").Parse(e.SQL)
+			if err != nil {
+				return nil
+			}
+			e.tmpl = tmpl
+		}
+
+		return e
+	})
+
+	_ = RegisterExpanderGenerator("geo", func(ps FilterPipelineParams) Expander {
+		e := &GeoExpander{
+			Lat:      ps.GetString("lat"),
+			Lng:      ps.GetString("lng"),
+			Distance: ps.GetString("distance"),
+		}
+
+		if e.Lat == "" || e.Lng == "" {
+			return nil
+		}
+
+		return e
+	})
+
+	_ = RegisterExpanderGenerator("bucket", func(ps FilterPipelineParams) Expander {
+		e := &BucketExpander{
+			Attr:    ps.GetString("attr"),
+			Buckets: bucketsOf(ps.Get("buckets")),
+		}
+
+		if e.Attr == "" || e.Buckets == nil {
+			return nil
+		}
+
+		return e
+	})
+
+	_ = RegisterExpanderGenerator("enum", func(ps FilterPipelineParams) Expander {
+		e := &EnumExpander{
+			Attr:   ps.GetString("attr"),
+			Field:  ps.GetString("field"),
+			Values: enumValuesOf(ps.Get("values")),
+		}
+
+		if e.Attr == "" || e.Values == nil {
+			return nil
+		}
+
+		return e
+	})
+
+	_ = RegisterExpanderGenerator("synonyms", func(ps FilterPipelineParams) Expander {
+		e := &SynonymsExpander{
+			Attr:     ps.GetString("attr"),
+			Synonyms: synonymsOf(ps.Get("synonyms")),
+		}
+
+		if file := ps.GetString("file"); file != "" && e.Synonyms == nil {
+			synonyms, err := loadSynonymsFile(file)
+
+			if err != nil {
+				return nil
+			}
+
+			e.Synonyms = synonyms
+		}
+
+		if e.Attr == "" || e.Synonyms == nil {
+			return nil
+		}
+
+		return e
+	})
+
+	_ = RegisterExpanderGenerator("lookup", func(ps FilterPipelineParams) Expander {
+		e := &LookupExpander{
+			Attr:  ps.GetString("attr"),
+			Query: ps.GetString("query"),
+			Match: ps.GetString("match"),
+		}
+
+		if e.Attr == "" || e.Match == "" || !strings.Contains(e.Query, "%where") {
+			return nil
+		}
+
+		switch ttl := ps.Get("ttl").(type) {
+		case nil:
+		case int:
+			e.TTL = time.Duration(ttl) * time.Second
+		case string:
+			d, err := time.ParseDuration(ttl)
+			if err != nil {
+				return nil
+			}
+			e.TTL = d
+		default:
+			return nil
+		}
+
+		return e
+	})
+}
+
+// Register the generator of pipeline type to global registry, it is available to all builders
+func RegisterExpanderGenerator(t string, gen ExpanderGenerator) error {
+	if gen == nil {
+		return fmt.Errorf("%s pipline type generator is nil", t)
+	}
+
+	generatorsMu.Lock()
+	defer generatorsMu.Unlock()
+
+	if _, ok := generators[t]; ok {
+		return fmt.Errorf("%s pipline type is registered", t)
 	}
 
+	generators[t] = gen
 	return nil
 }
 
-type FulltextSearchExpander struct {
-	Fields []string
+// Remove the pipeline type from global registry, it is used to clean up the types registered by tests
+func unregisterExpanderGenerator(t string) {
+	generatorsMu.Lock()
+	defer generatorsMu.Unlock()
+
+	delete(generators, t)
+}
+
+// Generator of pipeline type in global registry, nil if not registered
+func GenerateExpander(t string) ExpanderGenerator {
+	generatorsMu.RLock()
+	defer generatorsMu.RUnlock()
+
+	return generators[t]
+}
+
+// SubqueryExpander expand the filter to the condition of subquery, such as
+// users.uid IN (SELECT uid FROM orders WHERE orders.status = :orders_status)
+//
+// The filter is applied to Attr of the subquery with its operator, and the %where token of Query is replaced by it
+type SubqueryExpander struct {
+	Column string
+	Query  string
+	Attr   string
+}
+
+// Expand the subquery in the syntax of MySQL, use ExpandContext for the dialect of builder
+func (e *SubqueryExpander) Expand(origFilter Filter) (ConditionStmt, error) {
+	return e.expand(ConditionBuilder{Dialect: MySQL}, origFilter)
+}
+
+func (e *SubqueryExpander) ExpandContext(ec ExpansionContext, origFilter Filter) (ConditionStmt, error) {
+	return e.expand(ec.ConditionBuilder(), origFilter)
+}
+
+func (e *SubqueryExpander) expand(cb ConditionBuilder, origFilter Filter) (ConditionStmt, error) {
+	inner, err := cb.WhereAnd(&[]Filter{
+		{Attr: e.Attr, Op: origFilter.Op, Val: origFilter.Val},
+	})
+
+	if err != nil {
+		return inner, err
+	}
+
+	query, err := tokenReplace(e.Query, map[string]interface{}{
+		"where": inner,
+	})
+
+	if err != nil {
+		return inner, err
+	}
+
+	clause := fmt.Sprintf("%s IN (%s)", e.Column, query)
+
+	// the subquery is one condition of the pipeline attr
+	key := paramNameRegexp.ReplaceAllString(origFilter.Attr, "_")
+
+	return ConditionStmt{
+		Clause:      clause,
+		Arg:         inner.Arg,
+		ClauseSlice: map[string]string{key: clause},
+	}, nil
+}
+
+// TemplateExpander expand the filter to the sql fragment of template, placeholders of fragment are replaced
+// for each filter
+//
+//	{val}   the filter value bound as named arg
+//	{val.0} the element of slice value bound as named arg
+//	{op}    the sql operator of filter, such as =, IN and LIKE
+//
+// The fragment is executed as text/template first when it contains template actions, such as
+// {{if eq .Op "in"}}...{{end}}. The data is the TemplateData of filter, the value is never written to the sql
+type TemplateExpander struct {
+	SQL  string
+	tmpl *template.Template
+}
+
+// TemplateData is the data of template, it has the shape of value instead of the value
+type TemplateData struct {
+	Op   Operator
+	Attr string
+	// Kind of the value, such as string, int and slice, invalid for nil
+	Kind string
+	// Length of slice value, 1 for other values and 0 for nil
+	Len int
+}
+
+func templateDataOf(f Filter) TemplateData {
+	rv := reflect.ValueOf(f.Val)
+	data := TemplateData{Op: f.Op, Attr: f.Attr, Kind: rv.Kind().String()}
+
+	switch rv.Kind() {
+	case reflect.Invalid:
+	case reflect.Slice, reflect.Array:
+		data.Len = rv.Len()
+	default:
+		data.Len = 1
+	}
+
+	return data
 }
 
-func (e *FulltextSearchExpander) Expand(origFilter Filter) (ConditionStmt, error) {
-	var filters []Filter
-	filters = []Filter{}
+var templatePlaceholderRegexp = regexp.MustCompile(`{(val(\.(\d+))?|op)}`)
+
+func (e *TemplateExpander) Expand(origFilter Filter) (ConditionStmt, error) {
+	fragment := e.SQL
+
+	if e.tmpl != nil {
+		var sb strings.Builder
+
+		if err := e.tmpl.Execute(&sb, templateDataOf(origFilter)); err != nil {
+			return ConditionStmt{}, errors.Wrap(err, "template execute failure")
+		}
+
+		fragment = sb.String()
+	}
+
+	name := strings.Replace(origFilter.Attr, ".", "_", -1)
+	arg := map[string]interface{}{}
+
+	var err error
+
+	clause := templatePlaceholderRegexp.ReplaceAllStringFunc(fragment, func(ph string) string {
+		if err != nil {
+			return ph
+		}
+
+		m := templatePlaceholderRegexp.FindStringSubmatch(ph)
+
+		if m[1] == "op" {
+			var op string
+			op, err = templateOperator(origFilter.Op)
+			return op
+		}
+
+		key, val := name, origFilter.Val
+
+		if m[3] != "" {
+			i, _ := strconv.Atoi(m[3])
+			rv := reflect.ValueOf(val)
+
+			if rv.Kind() != reflect.Slice || rv.Len() <= i {
+				err = fmt.Errorf("%s value has no element %d", origFilter.Attr, i)
+				return ph
+			}
+
+			key, val = fmt.Sprintf("%s_%d", name, i), rv.Index(i).Interface()
+		}
+
+		switch origFilter.Op {
+		case StartsWith, Contains, EndsWith:
+			err = likeParamsProcess(val, key, origFilter.Op, arg)
+		default:
+			arg[key] = val
+		}
+
+		return ":" + key
+	})
+
+	if err != nil {
+		return ConditionStmt{}, err
+	}
+
+	return ConditionStmt{
+		Clause:      clause,
+		Arg:         arg,
+		ClauseSlice: map[string]string{name: clause},
+	}, nil
+}
 
-	for _, field := range e.Fields {
-		filters = append(filters, Filter{
-			Attr: field,
-			Op:   origFilter.Op,
-			Val:  origFilter.Val,
-		})
+// Sql operator of the filter operator, operators without value are not supported
+func templateOperator(op Operator) (string, error) {
+	switch op {
+	case Equal, NotEqual, Greater, Less, GreaterOrEqual, LessOrEqual:
+		return string(op), nil
+	case In:
+		return "IN", nil
+	case NotIn:
+		return "NOT IN", nil
+	case StartsWith, Contains, EndsWith:
+		return "LIKE", nil
 	}
 
-	return WhereOr(&filters)
+	return "", fmt.Errorf("operator %s not supported by template", op)
 }
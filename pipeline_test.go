@@ -0,0 +1,839 @@
+package sqlcomposer
+
+import (
+	"context"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+type upperExpander struct {
+	Attr string
+}
+
+func (e *upperExpander) Expand(origFilter Filter) (ConditionStmt, error) {
+	return WhereAnd(&[]Filter{
+		{Attr: e.Attr, Op: origFilter.Op, Val: strings.ToUpper(origFilter.Val.(string))},
+	})
+}
+
+func TestRegisterExpanderGenerator(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  filterPipelines:
+    upper_name:
+      type: test_upper
+      params:
+        - name: attr
+          value: users.name
+  fields:
+    base:
+      - name: name
+        expr: users.name
+  subject:
+    list: "SELECT %fields.base FROM users %where"`
+
+	upper := func(ps FilterPipelineParams) Expander {
+		if attr, ok := ps.Get("attr").(string); ok {
+			return &upperExpander{Attr: attr}
+		}
+		return nil
+	}
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		_, err := NewSqlBuilder(db, []byte(sqlComposition))
+		assert.Error(t, err, "type not registered")
+
+		assert.Error(t, RegisterExpanderGenerator("test_upper", nil))
+		assert.NoError(t, RegisterExpanderGenerator("test_upper", upper))
+		defer unregisterExpanderGenerator("test_upper")
+
+		assert.Error(t, RegisterExpanderGenerator("test_upper", upper))
+		assert.NotNil(t, GenerateExpander("test_upper"))
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: "barry", Op: Equal, Attr: "upper_name"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users WHERE ((users.name = ?))", q)
+		assert.Equal(t, []interface{}{"BARRY"}, a)
+
+		// override the generator for builder
+		sb, err = NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Error(t, sb.RegisterExpanderGenerator("test_upper", func(ps FilterPipelineParams) Expander {
+			return nil
+		}))
+		assert.Error(t, sb.RegisterPipelineType("test_unknown"))
+		assert.NoError(t, sb.RegisterExpanderGenerator("test_upper", func(ps FilterPipelineParams) Expander {
+			return &upperExpander{Attr: "users.nickname"}
+		}))
+
+		err = sb.AddFilters([]Filter{
+			{Val: "barry", Op: Equal, Attr: "upper_name"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "((users.nickname = :users_nickname))", sb.Conditions.Clause)
+
+		// type only registered to the builder
+		builderComposition := strings.Replace(sqlComposition, "test_upper", "test_builder_upper", 1)
+
+		_, err = NewSqlBuilder(db, []byte(builderComposition))
+		assert.Error(t, err)
+		assert.Nil(t, GenerateExpander("test_builder_upper"))
+
+		_, err = NewSqlBuilder(db, []byte(builderComposition), WithExpanderGenerators(map[string]ExpanderGenerator{
+			"test_builder_upper": nil,
+		}))
+		assert.Error(t, err)
+
+		_, err = NewSqlBuilder(db, []byte(builderComposition), WithExpanderGenerators(map[string]ExpanderGenerator{
+			"test_builder_upper": func(ps FilterPipelineParams) Expander { return nil },
+		}))
+		assert.Error(t, err, "invalid params")
+
+		sb, err = NewSqlBuilder(db, []byte(builderComposition), WithExpanderGenerators(map[string]ExpanderGenerator{
+			"test_builder_upper": upper,
+		}))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: "zoe", Op: Equal, Attr: "upper_name"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "((users.name = :users_name))", sb.Conditions.Clause)
+		assert.Equal(t, map[string]interface{}{"users_name": "ZOE"}, sb.Conditions.Arg)
+
+		// invalid params of builtin type
+		_, err = NewSqlBuilder(db, []byte(`
+composition:
+  filterPipelines:
+    attrs_fulltext:
+      type: fulltext
+      params:
+        - name: fields
+          value: product_spec`))
+		assert.Error(t, err)
+	})
+}
+
+func TestSubqueryExpander(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  filterPipelines:
+    order_amount:
+      type: subquery
+      params:
+        - name: column
+          value: users.uid
+        - name: query
+          value: "SELECT orders.uid FROM orders %where"
+        - name: attr
+          value: orders.total_amount
+    order_no:
+      type: subquery
+      params:
+        - name: column
+          value: users.uid
+        - name: query
+          value: "SELECT orders.uid FROM orders %where"
+        - name: attr
+          value: orders.order_no
+  fields:
+    base:
+      - name: name
+        expr: users.name
+  subject:
+    list: "SELECT %fields.base FROM users %where ORDER BY users.uid"
+    all: "SELECT %fields.base FROM users %where{!order_no} ORDER BY users.uid"
+    inner: "SELECT %fields.base FROM users %where{!orders_order_no} ORDER BY users.uid"`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: 50, Op: Greater, Attr: "order_amount"},
+			{Val: 100, Op: Less, Attr: "order_amount"},
+			{Val: []string{"001", "003"}, Op: In, Attr: "order_no"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users WHERE "+
+			"((users.uid IN (SELECT orders.uid FROM orders WHERE orders.order_no IN(?, ?))) AND "+
+			"((users.uid IN (SELECT orders.uid FROM orders WHERE orders.total_amount < ?)) AND "+
+			"((users.uid IN (SELECT orders.uid FROM orders WHERE orders.total_amount > ?))))) ORDER BY users.uid", q)
+		assert.Equal(t, []interface{}{"001", "003", 100, 50}, a)
+
+		var names []string
+		err = db.Select(&names, q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"Scott"}, names)
+
+		q, a, err = sb.Rebind("all")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users WHERE "+
+			"(((users.uid IN (SELECT orders.uid FROM orders WHERE orders.total_amount < ?)) AND "+
+			"((users.uid IN (SELECT orders.uid FROM orders WHERE orders.total_amount > ?))))) ORDER BY users.uid", q)
+		assert.Equal(t, []interface{}{100, 50}, a)
+
+		names = nil
+		err = db.Select(&names, q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"Scott"}, names)
+
+		// the attr of subquery is not the condition of outer query
+		q, a, err = sb.Rebind("inner")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Contains(t, q, "orders.order_no IN(?, ?)")
+		assert.Equal(t, []interface{}{"001", "003", 100, 50}, a)
+	})
+
+	// the subquery condition follows the dialect of builder
+	sb, err := NewSqlBuilder(nil, []byte(`
+composition:
+  filterPipelines:
+    channel:
+      type: subquery
+      params:
+        - name: column
+          value: users.uid
+        - name: query
+          value: "SELECT orders.uid FROM orders %where"
+        - name: attr
+          value: orders.meta->channel
+  subject:
+    list: "SELECT users.name FROM users %where"`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sb.Dialect = PostgreSQL
+
+	err = sb.AddFilters([]Filter{{Val: "^app", Op: Matches, Attr: "channel"}}, AND)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, a, err := sb.rebind("list", sqlx.DOLLAR)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "SELECT users.name FROM users WHERE "+
+		"((users.uid IN (SELECT orders.uid FROM orders WHERE orders.meta->>'channel' ~ $1)))", q)
+	assert.Equal(t, []interface{}{"^app"}, a)
+}
+
+func TestLookupExpander(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  filterPipelines:
+    order_no:
+      type: lookup
+      params:
+        - name: attr
+          value: users.uid
+        - name: query
+          value: "SELECT DISTINCT orders.uid FROM orders %where ORDER BY orders.uid"
+        - name: match
+          value: orders.order_no
+        - name: ttl
+          value: 1m
+  fields:
+    base:
+      - name: name
+        expr: users.name
+  subject:
+    list: "SELECT %fields.base FROM users %where ORDER BY users.uid"`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: []string{"001", "002", "003"}, Op: In, Attr: "order_no"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users WHERE ((users.uid IN(?, ?))) ORDER BY users.uid", q)
+		assert.Equal(t, []interface{}{int64(1), int64(2)}, a)
+
+		// ids are cached, the deleted order still matched
+		db.MustExec("DELETE FROM orders WHERE order_no = '003'")
+
+		sb.Reset()
+		err = sb.AddFilters([]Filter{
+			{Val: []string{"001", "002", "003"}, Op: In, Attr: "order_no"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, a, err = sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []interface{}{int64(1), int64(2)}, a)
+
+		sb.Reset()
+		err = sb.AddFilters([]Filter{
+			{Val: "999", Op: Equal, Attr: "order_no"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, _, err = sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users WHERE ((1 = 0)) ORDER BY users.uid", q)
+
+		_, err = (&LookupExpander{Attr: "users.uid"}).Expand(Filter{Val: "001", Op: Equal, Attr: "order_no"})
+		assert.Error(t, err)
+
+		// builder without cache query every time
+		sb, err = NewSqlBuilder(db, []byte(sqlComposition), WithLookupCache(nil))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: []string{"001", "002", "003"}, Op: In, Attr: "order_no"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, a, err = sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []interface{}{int64(1)}, a)
+	})
+}
+
+func TestLookupCache(t *testing.T) {
+	c := NewLookupCache(2)
+
+	c.set("a", []interface{}{1}, time.Minute)
+	c.set("b", []interface{}{2}, time.Hour)
+	c.set("c", []interface{}{3}, time.Hour)
+
+	// the entry expires first is evicted when full
+	assert.Equal(t, 2, c.Len())
+	_, ok := c.get("a")
+	assert.False(t, ok)
+
+	ids, ok := c.get("c")
+	assert.True(t, ok)
+	assert.Equal(t, []interface{}{3}, ids)
+
+	// expired entries are swept on insert
+	c = NewLookupCache(10)
+	c.set("a", []interface{}{1}, -time.Second)
+	c.set("b", []interface{}{2}, -time.Second)
+	c.set("c", []interface{}{3}, time.Minute)
+	assert.Equal(t, 1, c.Len())
+
+	c = NewLookupCache(0)
+	c.set("a", []interface{}{1}, time.Minute)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestTemplateExpander(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  filterPipelines:
+    age_range:
+      type: template
+      params:
+        - name: sql
+          value: "users.age >= {val.0} AND users.age <= {val.1}"
+    name_like:
+      type: template
+      combineOp: OR
+      params:
+        - name: sql
+          value: "users.name {op} {val}"
+    uid:
+      type: template
+      params:
+        - name: sql
+          value: "{{if eq .Op \"in\"}}users.uid {op} ({val}){{else}}users.uid {op} {val}{{end}}"
+  fields:
+    base:
+      - name: name
+        expr: users.name
+  subject:
+    list: "SELECT %fields.base FROM users %where ORDER BY users.uid"`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: "Scott", Op: Equal, Attr: "users.name"},
+			{Val: "oe", Op: Contains, Attr: "name_like"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users WHERE ((users.name LIKE ?) OR (users.name = ?)) "+
+			"ORDER BY users.uid", q)
+		assert.Equal(t, []interface{}{"%oe%", "Scott"}, a)
+
+		var names []string
+		err = db.Select(&names, q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"Scott", "Zoe"}, names)
+
+		sb.Reset()
+		err = sb.AddFilters([]Filter{
+			{Val: []int{21, 30}, Op: Between, Attr: "age_range"},
+			{Val: []int{2, 3}, Op: In, Attr: "uid"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err = sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users WHERE ((users.uid IN (?, ?)) AND "+
+			"((users.age >= ? AND users.age <= ?))) ORDER BY users.uid", q)
+		assert.Equal(t, []interface{}{2, 3, 21, 30}, a)
+
+		names = nil
+		err = db.Select(&names, q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"Barry", "Zoe"}, names)
+
+		sb.Reset()
+		err = sb.AddFilters([]Filter{
+			{Val: []int{21}, Op: Between, Attr: "age_range"},
+		}, AND)
+		assert.Error(t, err)
+
+		err = sb.AddFilters([]Filter{
+			{Op: IsNull, Attr: "name_like"},
+		}, AND)
+		assert.Error(t, err)
+	})
+
+	// the value never reaches the sql text, it is bound as named arg
+	injection := "x' OR '1'='1"
+
+	stmt, err := (&TemplateExpander{SQL: "users.name = {val}"}).Expand(Filter{Val: injection, Op: Equal, Attr: "name"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "users.name = :name", stmt.Clause)
+	assert.Equal(t, map[string]interface{}{"name": injection}, stmt.Arg)
+
+	gen := GenerateExpander("template")
+
+	e := gen(FilterPipelineParams{{Name: "sql", Value: "users.name = '{{.Val}}'"}})
+	_, err = e.Expand(Filter{Val: injection, Op: Equal, Attr: "name"})
+	assert.Error(t, err)
+
+	e = gen(FilterPipelineParams{{Name: "sql", Value: "{{if gt .Len 1}}users.uid IN ({val}){{else}}users.uid = {val.0}{{end}}"}})
+	stmt, err = e.Expand(Filter{Val: []string{injection}, Op: In, Attr: "uid"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "users.uid = :uid_0", stmt.Clause)
+	assert.Equal(t, map[string]interface{}{"uid_0": injection}, stmt.Arg)
+	assert.NotContains(t, stmt.Clause, "'")
+
+	_, err = NewSqlBuilder(nil, []byte(`
+composition:
+  filterPipelines:
+    name_like:
+      type: template
+      combineOp: XOR
+      params:
+        - name: sql
+          value: "users.name {op} {val}"`))
+	assert.Error(t, err)
+}
+
+// splitRewriter split the comma separated value to filters of Attr combined by OR
+type splitRewriter struct {
+	Attr string
+}
+
+func (e *splitRewriter) Rewrite(origFilter Filter) (FilterGroup, error) {
+	group := FilterGroup{LogicOp: OR}
+
+	for _, v := range strings.Split(origFilter.Val.(string), ",") {
+		group.Filters = append(group.Filters, &Filter{Attr: e.Attr, Op: origFilter.Op, Val: v})
+	}
+
+	return group, nil
+}
+
+func (e *splitRewriter) RewriteTargets() []string {
+	return []string{e.Attr}
+}
+
+func (e *splitRewriter) Expand(origFilter Filter) (ConditionStmt, error) {
+	group, err := e.Rewrite(origFilter)
+
+	if err != nil {
+		return ConditionStmt{}, err
+	}
+
+	var filters []Filter
+	for _, f := range group.Filters {
+		filters = append(filters, *f)
+	}
+
+	return Conditions(&filters, group.LogicOp)
+}
+
+func TestSqlBuilder_PipelineChain(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  filterPipelines:
+    names:
+      type: test_split
+      params:
+        - name: attr
+          value: keyword
+    keyword:
+      type: fulltext
+      params:
+        - name: fields
+          value: [users.name]
+    plain:
+      type: test_split
+      params:
+        - name: attr
+          value: plain
+  fields:
+    base:
+      - name: name
+        expr: users.name
+  subject:
+    list: "SELECT %fields.base FROM users %where ORDER BY users.uid"`
+
+	assert.NoError(t, RegisterExpanderGenerator("test_split", func(ps FilterPipelineParams) Expander {
+		if attr := ps.GetString("attr"); attr != "" {
+			return &splitRewriter{Attr: attr}
+		}
+		return nil
+	}))
+	defer unregisterExpanderGenerator("test_split")
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: "Sc,Zo", Op: StartsWith, Attr: "names"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users WHERE (((users.name LIKE ?) OR ((users.name LIKE ?)))) "+
+			"ORDER BY users.uid", q)
+		assert.Equal(t, []interface{}{"Zo%", "Sc%"}, a)
+
+		var names []string
+		err = db.Select(&names, q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"Scott", "Zoe"}, names)
+
+		// filters emitted to the attr of rewriter itself are plain conditions
+		sb.Reset()
+		err = sb.AddFilters([]Filter{
+			{Val: "1,2", Op: Equal, Attr: "plain"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "((plain = :plain OR plain = :plain_1))", sb.Conditions.Clause)
+
+		// the cycle of rewriters is rejected on construction
+		_, err = NewSqlBuilder(db, []byte(`
+composition:
+  filterPipelines:
+    loop_a:
+      type: test_split
+      params:
+        - name: attr
+          value: loop_b
+    loop_b:
+      type: test_split
+      params:
+        - name: attr
+          value: loop_a
+  subject:
+    list: "SELECT users.name FROM users %where"`))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "loop_a -> loop_b -> loop_a")
+
+		_, err = NewSqlBuilder(db, []byte(`
+composition:
+  filterPipelines:
+    loop_a:
+      type: test_split
+      params:
+        - name: attr
+          value: loop_b
+  subject:
+    list:
+      sql: "SELECT users.name FROM users %where"
+      filterPipelines:
+        loop_b:
+          type: test_split
+          params:
+            - name: attr
+              value: loop_a`))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "list subject")
+	})
+}
+
+type teamUser struct {
+	Uid  int
+	Team []int
+}
+
+// teamExpander filter users of the team of current user
+type teamExpander struct{}
+
+func (e *teamExpander) Expand(origFilter Filter) (ConditionStmt, error) {
+	return ConditionStmt{}, errors.New("team filter need the current user")
+}
+
+func (e *teamExpander) ExpandContext(ec ExpansionContext, origFilter Filter) (ConditionStmt, error) {
+	if err := ec.Context.Err(); err != nil {
+		return ConditionStmt{}, err
+	}
+
+	u, ok := ec.User.(*teamUser)
+
+	if !ok || ec.DB == nil || ec.Dialect != SQLite {
+		return e.Expand(origFilter)
+	}
+
+	return WhereAnd(&[]Filter{
+		{Attr: "users.uid", Op: In, Val: append([]int{u.Uid}, u.Team...)},
+	})
+}
+
+func TestSqlBuilder_ContextExpander(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  filterPipelines:
+    my_team:
+      type: test_team
+  fields:
+    base:
+      - name: name
+        expr: users.name
+  subject:
+    list: "SELECT %fields.base FROM users %where ORDER BY users.uid"`
+
+	assert.NoError(t, RegisterExpanderGenerator("test_team", func(ps FilterPipelineParams) Expander {
+		return &teamExpander{}
+	}))
+	defer unregisterExpanderGenerator("test_team")
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, Dialect(SQLite), sb.Dialect)
+
+		err = sb.AddFilters([]Filter{{Val: true, Op: Equal, Attr: "my_team"}}, AND)
+		assert.Error(t, err)
+
+		sb.User = &teamUser{Uid: 1, Team: []int{3}}
+		err = sb.AddFilters([]Filter{{Val: true, Op: Equal, Attr: "my_team"}}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		err = sb.SelectContext(context.Background(), db, &names, "list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"Scott", "Zoe"}, names)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err = sb.Clone().AddFiltersContext(ctx, []Filter{{Val: true, Op: Equal, Attr: "my_team"}}, AND)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,121 @@
+package sqlcomposer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Relation to another table, filters address the related attributes such as orders.status are compiled to
+// EXISTS subquery instead of join the table
+//
+//	relations:
+//	  orders:
+//	    table: orders
+//	    alias: o
+//	    localKey: users.uid
+//	    foreignKey: uid
+//	  never_ordered:
+//	    table: orders
+//	    localKey: users.uid
+//	    foreignKey: uid
+//	    negate: true
+type RelationDefinition struct {
+	Table      string `yaml:"table"`
+	Alias      string `yaml:"alias,omitempty"`
+	LocalKey   string `yaml:"localKey"`
+	ForeignKey string `yaml:"foreignKey"`
+	// Render NOT EXISTS
+	Negate bool `yaml:"negate,omitempty"`
+}
+
+func (r RelationDefinition) validate(name string) error {
+	if r.Table == "" || r.LocalKey == "" || r.ForeignKey == "" {
+		return fmt.Errorf("relation %s must have table, localKey and foreignKey", name)
+	}
+
+	return nil
+}
+
+func (r RelationDefinition) alias(name string) string {
+	if r.Alias != "" {
+		return r.Alias
+	}
+
+	return name
+}
+
+// Build the EXISTS clause of the relation, filters are combined by the operator in the subquery
+func (r RelationDefinition) exists(cb ConditionBuilder, name string, filters []Filter, op LogicOperator) (ConditionStmt, error) {
+	alias := r.alias(name)
+
+	inner := make([]Filter, len(filters))
+	for i, f := range filters {
+		f.Attr = alias + strings.TrimPrefix(f.Attr, name)
+		inner[i] = f
+	}
+
+	stmt, err := cb.Conditions(&inner, op)
+
+	if err != nil {
+		return stmt, err
+	}
+
+	fk := r.ForeignKey
+	if !strings.Contains(fk, ".") {
+		fk = alias + "." + fk
+	}
+
+	keyword := "EXISTS"
+	if r.Negate {
+		keyword = "NOT EXISTS"
+	}
+
+	clause := fmt.Sprintf("%s (SELECT 1 FROM %s AS %s WHERE %s = %s AND (%s))",
+		keyword, r.Table, alias, fk, r.LocalKey, stmt.Clause)
+
+	return ConditionStmt{
+		Clause:      clause,
+		Arg:         stmt.Arg,
+		ClauseSlice: map[string]string{name: clause},
+	}, nil
+}
+
+// Split the filters address the related attributes from others, related filters are grouped by the relation name
+func (sc *SqlBuilder) groupRelationFilters(filters []Filter) (rest []Filter, related map[string][]Filter) {
+	related = make(map[string][]Filter)
+
+	for _, f := range filters {
+		name := strings.SplitN(f.Attr, ".", 2)[0]
+
+		if _, ok := sc.Doc.Composition.Relations[name]; ok && name != f.Attr {
+			related[name] = append(related[name], f)
+		} else {
+			rest = append(rest, f)
+		}
+	}
+
+	return rest, related
+}
+
+func (sc *SqlBuilder) combineRelations(stmt ConditionStmt, related map[string][]Filter, op LogicOperator) (ConditionStmt, error) {
+	var names []string
+	for name := range related {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	stmts := []ConditionStmt{stmt}
+
+	for _, name := range names {
+		s, err := sc.Doc.Composition.Relations[name].exists(sc.conditionBuilder(), name, related[name], op)
+
+		if err != nil {
+			return stmt, err
+		}
+
+		stmts = append(stmts, s)
+	}
+
+	return Combine(op, stmts...), nil
+}
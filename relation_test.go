@@ -0,0 +1,123 @@
+package sqlcomposer
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSqlBuilder_RelationFilters(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  relations:
+    orders:
+      table: orders
+      alias: o
+      localKey: users.uid
+      foreignKey: uid
+    never_ordered:
+      table: orders
+      localKey: users.uid
+      foreignKey: uid
+      negate: true
+  fields:
+    base:
+      - name: name
+        expr: users.name
+  subject:
+    list: "SELECT %fields.base FROM users %where ORDER BY users.uid"
+    all: "SELECT %fields.base FROM users %where{!orders} ORDER BY users.uid"`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: 20, Op: Greater, Attr: "users.age"},
+			{Val: 20, Op: Greater, Attr: "orders.total_amount"},
+			{Val: 100, Op: Less, Attr: "orders.total_amount"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users WHERE ((users.age > ?) AND "+
+			"(EXISTS (SELECT 1 FROM orders AS o WHERE o.uid = users.uid AND "+
+			"(o.total_amount > ? AND o.total_amount < ?)))) ORDER BY users.uid", q)
+		assert.Equal(t, []interface{}{20, 20, 100}, a)
+
+		var names []string
+		err = db.Select(&names, q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"Barry"}, names)
+
+		q, a, err = sb.Rebind("all")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users WHERE ((users.age > ?)) ORDER BY users.uid", q)
+		assert.Equal(t, []interface{}{20}, a)
+
+		sb, err = NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: "001", Op: Equal, Attr: "never_ordered.order_no"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err = sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users WHERE ((NOT EXISTS (SELECT 1 FROM orders AS never_ordered "+
+			"WHERE never_ordered.uid = users.uid AND (never_ordered.order_no = ?)))) ORDER BY users.uid", q)
+
+		names = nil
+		err = db.Select(&names, q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"Barry", "Zoe"}, names)
+	})
+
+	_, err := NewSqlBuilder(nil, []byte(`
+composition:
+  relations:
+    orders:
+      table: orders
+      localKey: users.uid`))
+
+	assert.Error(t, err)
+}
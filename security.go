@@ -0,0 +1,56 @@
+package sqlcomposer
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+// Add row level security filters, such as the tenant of request. They are ANDed to every where and having token of
+// the filter scope, could not be excluded by token params, and the subject must have a where token of the scope
+func (sc *SqlBuilder) AddSecurityFilters(f ...Filter) error {
+	groups, scopes := groupFiltersByScope(f, func(f Filter) string {
+		return f.Scope
+	})
+
+	for _, scope := range scopes {
+		filters := groups[scope]
+		stmt, err := sc.conditionBuilder().WhereAnd(&filters)
+
+		if err != nil {
+			return errors.Wrap(err, "add security filters to SqlBuilder failure")
+		}
+
+		if current, ok := sc.security[scope]; ok {
+			stmt = CombineAnd(*current, stmt)
+		}
+
+		sc.security[scope] = &stmt
+	}
+
+	return nil
+}
+
+// Security conditions of the scope
+func (sc *SqlBuilder) SecurityConditions(scope string) *ConditionStmt {
+	if c, ok := sc.security[scope]; ok {
+		return c
+	}
+
+	return &ConditionStmt{}
+}
+
+// Check the where token of every secured scope is rendered
+func (sc *SqlBuilder) checkSecurityRendered(rendered map[string]*bool) error {
+	for scope := range sc.security {
+		if r, ok := rendered[scope]; !ok || !*r {
+			token := "where"
+			if scope != "" {
+				token = "where." + scope
+			}
+
+			return fmt.Errorf("security conditions required but %%%s token not in subject", token)
+		}
+	}
+
+	return nil
+}
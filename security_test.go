@@ -0,0 +1,89 @@
+package sqlcomposer
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSqlBuilder_AddSecurityFilters(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  fields:
+    base:
+      - name: name
+        expr: users.name
+    statistic:
+      - name: consume_total
+        expr: SUM(orders.total_amount)
+  subject:
+    list: "SELECT %fields.base, %fields.statistic FROM users LEFT JOIN orders ON orders.uid = users.uid %where{!users_uid,consume_total} GROUP BY users.uid %having{consume_total}"
+    all: "SELECT %fields.base FROM users %where{!users_uid}"
+    outer: "SELECT * FROM (SELECT %fields.base FROM users %where.inner) t"
+    unsafe: "SELECT %fields.base FROM users"`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddSecurityFilters(Filter{Val: 1, Op: Equal, Attr: "users.uid"})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: 2, Op: Equal, Attr: "users.uid"},
+			{Val: 10, Op: Greater, Attr: "consume_total"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name, SUM(orders.total_amount) AS consume_total "+
+			"FROM users LEFT JOIN orders ON orders.uid = users.uid WHERE users.uid = ? "+
+			"GROUP BY users.uid HAVING ((consume_total > ?)) AND (users.uid = ?)", q)
+		assert.Equal(t, []interface{}{1, 10, 1}, a)
+
+		q, a, err = sb.Rebind("all")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users WHERE ((consume_total > ?)) AND (users.uid = ?)", q)
+		assert.Equal(t, []interface{}{10, 1}, a)
+
+		_, _, err = sb.Rebind("unsafe")
+		assert.Error(t, err)
+
+		err = sb.AddSecurityFilters(Filter{Val: 3, Op: Equal, Attr: "users.uid", Scope: "inner"})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the subject has no %where token of the default scope
+		_, _, err = sb.Rebind("outer")
+		assert.Error(t, err)
+
+		// the subject has no %where.inner token
+		_, _, err = sb.Rebind("all")
+		assert.Error(t, err)
+	})
+}
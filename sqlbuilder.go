@@ -1,11 +1,14 @@
 package sqlcomposer
 
 import (
+	"context"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 	"regexp"
+	"sort"
+	"strings"
 )
 
 type SqlCompositionFields map[string]SqlCompositionFieldGroup
@@ -41,9 +44,29 @@ func (p *FilterPipelineParams) Get(key string) interface{} {
 	return nil
 }
 
+// Get the string param, empty string if the param not exists or not string
+func (p *FilterPipelineParams) GetString(key string) string {
+	if s, ok := p.Get(key).(string); ok {
+		return s
+	}
+	return ""
+}
+
 type FilterPipelineDefinition struct {
 	Type   string               `yaml:"type"`
 	Params FilterPipelineParams `yaml:"params,omitempty"`
+	// Scope the expanded conditions render to, empty means the scope of the filter
+	Scope string `yaml:"scope,omitempty"`
+	// Logic operator combine the expanded conditions with others, AND by default
+	CombineOp LogicOperator `yaml:"combineOp,omitempty"`
+}
+
+func (p FilterPipelineDefinition) combineOp() LogicOperator {
+	if p.CombineOp == "" {
+		return AND
+	}
+
+	return p.CombineOp
 }
 
 type SqlApiDoc struct {
@@ -55,25 +78,67 @@ type SqlApiDoc struct {
 		Fields            SqlCompositionFields                `yaml:"fields"`
 		Tokens            map[string]TokenDefinition          `yaml:"tokens,omitempty"`
 		FilterPipelines   map[string]FilterPipelineDefinition `yaml:"filterPipelines,omitempty"`
-		DefaultConditions []Filter                            `yaml:"defaultConditions,omitempty"`
-		Subject           map[string]string                   `yaml:"subject"`
+		Relations         map[string]RelationDefinition       `yaml:"relations,omitempty"`
+		Attributes        map[string]AttributeDefinition      `yaml:"attributes,omitempty"`
+		DefaultConditions []DefaultCondition                  `yaml:"defaultConditions,omitempty"`
+		Subject           map[string]SubjectDefinition        `yaml:"subject"`
 	} `yaml:"composition"`
 }
 
 type ExpanderGenerator func(params FilterPipelineParams) Expander
 
-// SqlBuilder be responsible for build sql from yaml config
+// SqlBuilder be responsible for build sql from yaml config. Dialect is detected by the driver name of DB, and
+// User of the request is passed to the context expanders
 type SqlBuilder struct {
 	DB         *sqlx.DB
 	Doc        *SqlApiDoc
+	Dialect    Dialect
+	User       interface{}
 	Conditions *ConditionStmt
+	scopes     map[string]*ConditionStmt
+	filtered   map[scopedAttr]bool
+	removed    map[string]bool
+	security   map[string]*ConditionStmt
 	orderBy    *OrderBy
 	limit      *SqlLimit
 	tokens     map[string]interface{}
 	pipelines  map[string]ExpanderGenerator
+	fields     map[string]*ConditionStmt
+	subjects   map[string]*subjectState
+	limited    bool
+	// row converters of the doc pipelines keyed by empty string, and of the subjects have their own pipelines
+	converters map[string][]RowConverter
+	// shared with clones
+	lookupCache *LookupCache
 }
 
-func NewSqlBuilder(db *sqlx.DB, yamlFile []byte) (*SqlBuilder, error) {
+// BuilderOption configure the builder before the doc is validated
+type BuilderOption func(sc *SqlBuilder) error
+
+// Register the generators of pipeline types for the builder, the doc could use the types only registered by them
+func WithExpanderGenerators(gens map[string]ExpanderGenerator) BuilderOption {
+	return func(sc *SqlBuilder) error {
+		for t, gen := range gens {
+			if gen == nil {
+				return fmt.Errorf("%s pipline type generator is nil", t)
+			}
+
+			sc.pipelines[t] = gen
+		}
+
+		return nil
+	}
+}
+
+// Share the lookup cache between builders, nil disable the cache
+func WithLookupCache(cache *LookupCache) BuilderOption {
+	return func(sc *SqlBuilder) error {
+		sc.lookupCache = cache
+		return nil
+	}
+}
+
+func NewSqlBuilder(db *sqlx.DB, yamlFile []byte, opts ...BuilderOption) (*SqlBuilder, error) {
 	doc := SqlApiDoc{}
 
 	err := yaml.Unmarshal(yamlFile, &doc)
@@ -82,24 +147,177 @@ func NewSqlBuilder(db *sqlx.DB, yamlFile []byte) (*SqlBuilder, error) {
 		return nil, errors.Wrap(err, "Construct SqlBuilder failure")
 	}
 
-	filterStmt := new(ConditionStmt)
+	if err = validateDefaultConditions(doc.Composition.DefaultConditions); err != nil {
+		return nil, err
+	}
 
-	if doc.Composition.DefaultConditions != nil {
-		*filterStmt, err = WhereAnd(&doc.Composition.DefaultConditions)
-		if err != nil {
-			return nil, errors.Wrap(err, "default conditions process failure")
+	for name, r := range doc.Composition.Relations {
+		if err = r.validate(name); err != nil {
+			return nil, err
+		}
+	}
+
+	for attr, a := range doc.Composition.Attributes {
+		if err = a.validate(attr); err != nil {
+			return nil, err
 		}
 	}
 
-	return &SqlBuilder{
+	// the dialect of unknown driver is MySQL, as the package level Conditions
+	dialect := Dialect(MySQL)
+	if db != nil {
+		if d := DialectOf(db.DriverName()); d != "" {
+			dialect = d
+		}
+	}
+
+	sc := &SqlBuilder{
 		DB:         db,
 		Doc:        &doc,
-		Conditions: filterStmt,
+		Dialect:    dialect,
+		Conditions: new(ConditionStmt),
+		scopes:     make(map[string]*ConditionStmt),
+		filtered:   make(map[scopedAttr]bool),
+		removed:    make(map[string]bool),
+		security:   make(map[string]*ConditionStmt),
 		orderBy:    new(OrderBy),
 		limit:      &SqlLimit{0, 10},
 		tokens:     make(map[string]interface{}),
 		pipelines:  make(map[string]ExpanderGenerator),
-	}, nil
+		fields:     make(map[string]*ConditionStmt),
+		subjects:   make(map[string]*subjectState),
+
+		lookupCache: NewLookupCache(DefaultLookupCacheSize),
+	}
+
+	for _, opt := range opts {
+		if err = opt(sc); err != nil {
+			return nil, errors.Wrap(err, "Construct SqlBuilder failure")
+		}
+	}
+
+	if err = sc.validatePipelineDefinitions(doc.Composition.FilterPipelines); err != nil {
+		return nil, err
+	}
+
+	if err = sc.validatePipelineChain(doc.Composition.FilterPipelines); err != nil {
+		return nil, err
+	}
+
+	for key, def := range doc.Composition.Subject {
+		if err = validateDefaultConditions(def.DefaultConditions); err != nil {
+			return nil, errors.Wrapf(err, "%s subject", key)
+		}
+
+		if err = sc.validatePipelineDefinitions(def.FilterPipelines); err != nil {
+			return nil, errors.Wrapf(err, "%s subject", key)
+		}
+
+		if len(def.FilterPipelines) > 0 {
+			st := newSubjectState(doc.Composition.FilterPipelines, def.FilterPipelines)
+
+			if err = sc.validatePipelineChain(st.pipelines); err != nil {
+				return nil, errors.Wrapf(err, "%s subject", key)
+			}
+
+			sc.subjects[key] = st
+		}
+	}
+
+	sc.buildRowConverters()
+
+	return sc, nil
+}
+
+func validateDefaultConditions(dcs []DefaultCondition) error {
+	for _, dc := range dcs {
+		if err := dc.validate(); err != nil {
+			return errors.Wrap(err, "default conditions process failure")
+		}
+	}
+
+	return nil
+}
+
+// Check the pipelines have generator of the builder or global registry, and valid settings
+func (sc *SqlBuilder) validatePipelineDefinitions(pipelines map[string]FilterPipelineDefinition) error {
+	for attr, p := range pipelines {
+		gen := sc.expanderGenerator(p.Type)
+
+		if gen == nil {
+			return fmt.Errorf("%s pipeline type %s has no expander generator registered", attr, p.Type)
+		}
+
+		if op := p.combineOp(); op != AND && op != OR {
+			return fmt.Errorf("%s pipeline combine operator %s is invalid", attr, op)
+		}
+
+		if err := validatePipelines(sc.Doc, p.Type, gen); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Check the pipelines chained by the rewriters of known targets have no cycle, the filter emitted to the attr of
+// rewriter itself is a plain condition but not a cycle
+func (sc *SqlBuilder) validatePipelineChain(pipelines map[string]FilterPipelineDefinition) error {
+	targets := make(map[string][]string, len(pipelines))
+
+	for attr, p := range pipelines {
+		gen := sc.expanderGenerator(p.Type)
+		if gen == nil {
+			continue
+		}
+
+		if rw, ok := gen(p.Params).(TargetedRewriter); ok {
+			for _, t := range rw.RewriteTargets() {
+				if _, ok := pipelines[t]; ok && t != attr {
+					targets[attr] = append(targets[attr], t)
+				}
+			}
+		}
+	}
+
+	attrs := make([]string, 0, len(targets))
+	for attr := range targets {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+
+	done := map[string]bool{}
+
+	var visit func(attr string, path []string) error
+	visit = func(attr string, path []string) error {
+		for _, a := range path {
+			if a == attr {
+				return fmt.Errorf("pipeline cycle detected: %s", strings.Join(append(path, attr), " -> "))
+			}
+		}
+
+		if done[attr] {
+			return nil
+		}
+
+		for _, t := range targets[attr] {
+			if err := visit(t, append(append([]string{}, path...), attr)); err != nil {
+				return err
+			}
+		}
+
+		done[attr] = true
+
+		return nil
+	}
+
+	for _, attr := range attrs {
+		if err := visit(attr, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // Deprecated
@@ -121,51 +339,261 @@ func (sc *SqlBuilder) InjectionSimpleToken(name string, gen func(params []TokenP
 	}
 }
 
+// Register the pipeline type with the generator in global registry
 func (sc *SqlBuilder) RegisterPipelineType(t string) error {
-	if _, ok := sc.pipelines[t]; !ok {
-		sc.pipelines[t] = GenerateExpander(t)
-		return nil
+	gen := GenerateExpander(t)
+
+	if gen == nil {
+		return fmt.Errorf("%s pipline type has no expander generator", t)
 	}
 
-	return fmt.Errorf("%s pipline type is registered", t)
+	return sc.RegisterExpanderGenerator(t, gen)
+}
+
+// Register the generator of pipeline type for this builder, it overrides the generator in global registry
+func (sc *SqlBuilder) RegisterExpanderGenerator(t string, gen ExpanderGenerator) error {
+	if gen == nil {
+		return fmt.Errorf("%s pipline type generator is nil", t)
+	}
+
+	if _, ok := sc.pipelines[t]; ok {
+		return fmt.Errorf("%s pipline type is registered", t)
+	}
+
+	if err := validatePipelines(sc.Doc, t, gen); err != nil {
+		return err
+	}
+
+	sc.pipelines[t] = gen
+	sc.buildRowConverters()
+
+	return nil
+}
+
+// Generator of the pipeline type, the generator registered to builder is preferred
+func (sc *SqlBuilder) expanderGenerator(t string) ExpanderGenerator {
+	if gen, ok := sc.pipelines[t]; ok {
+		return gen
+	}
+
+	return GenerateExpander(t)
+}
+
+// Check the pipelines of type t in doc and subjects could be generated by gen
+func validatePipelines(doc *SqlApiDoc, t string, gen ExpanderGenerator) error {
+	all := []map[string]FilterPipelineDefinition{doc.Composition.FilterPipelines}
+	for _, def := range doc.Composition.Subject {
+		all = append(all, def.FilterPipelines)
+	}
+
+	for _, pipelines := range all {
+		for attr, p := range pipelines {
+			if p.Type == t && gen(p.Params) == nil {
+				return fmt.Errorf("%s pipeline of type %s generate expander failure, check the params", attr, t)
+			}
+		}
+	}
+
+	return nil
 }
 
 func (sc *SqlBuilder) AndConditions(c *ConditionStmt) *SqlBuilder {
-	combined := Combine(AND, *sc.Conditions, *c)
-	sc.Conditions = &combined
+	sc.combineScope("", AND, *c)
 	return sc
 }
 
 func (sc *SqlBuilder) OrConditions(c *ConditionStmt) *SqlBuilder {
-	combined := Combine(OR, *sc.Conditions, *c)
-	sc.Conditions = &combined
+	sc.combineScope("", OR, *c)
 	return sc
 }
 
 func (sc *SqlBuilder) SetConditions(c *ConditionStmt) *SqlBuilder {
 	sc.Conditions = c
+
+	for _, st := range sc.subjects {
+		stmt := c.Clone()
+		st.scopes[""] = &stmt
+	}
+
 	return sc
 }
 
+// Conditions of the scope, the empty scope is the Conditions of builder. Default conditions are not included, they
+// are applied when the subject is composed
+func (sc *SqlBuilder) ScopedConditions(scope string) *ConditionStmt {
+	if scope == "" {
+		return sc.Conditions
+	}
+
+	if c, ok := sc.scopes[scope]; ok {
+		return c
+	}
+
+	return &ConditionStmt{}
+}
+
+func (sc *SqlBuilder) AndScopedConditions(scope string, c *ConditionStmt) *SqlBuilder {
+	sc.combineScope(scope, AND, *c)
+	return sc
+}
+
+func (sc *SqlBuilder) OrScopedConditions(scope string, c *ConditionStmt) *SqlBuilder {
+	sc.combineScope(scope, OR, *c)
+	return sc
+}
+
+// Combine the conditions to the scope of builder and every subject has its own pipelines
+func (sc *SqlBuilder) combineScope(scope string, op LogicOperator, c ConditionStmt) {
+	sc.combineDocScope(scope, op, c)
+
+	for _, st := range sc.subjects {
+		st.combine(scope, op, c)
+	}
+}
+
+func (sc *SqlBuilder) combineDocScope(scope string, op LogicOperator, c ConditionStmt) {
+	combined := Combine(op, *sc.ScopedConditions(scope), c)
+
+	if scope == "" {
+		sc.Conditions = &combined
+	} else {
+		sc.scopes[scope] = &combined
+	}
+}
+
+// Add filters to the scope of each filter, filters of pipeline with scope are moved to the scope of pipeline
 func (sc *SqlBuilder) AddFilters(f []Filter, operator LogicOperator) error {
-	condition, err := sc.applyPipelines(f, operator)
+	return sc.AddFiltersContext(context.Background(), f, operator)
+}
+
+// Add filters with the context, it is passed to the pipelines query the database, such as lookup. Filters are
+// compiled with the pipelines of doc, and with the pipelines of every subject has its own pipelines. Filters of the
+// pipeline declared only by some subjects are not applied to others, and nothing is added if any compiling fails
+func (sc *SqlBuilder) AddFiltersContext(ctx context.Context, f []Filter, operator LogicOperator) error {
+	// the expanded conditions are shared by the states of same pipeline
+	ctx = context.WithValue(ctx, pipelineMemoKey{}, pipelineMemo{})
+
+	doc, err := sc.compileFilters(ctx, sc.docState(), f, operator)
 
 	if err != nil {
 		return errors.Wrap(err, "add filters to SqlBuilder failure")
 	}
 
-	combined := CombineAnd(*sc.Conditions, condition)
-	sc.Conditions = &combined
+	keys := sortedSubjectKeys(sc.subjects)
+	subjects := make([]*compiledFilters, len(keys))
+
+	for i, key := range keys {
+		if subjects[i], err = sc.compileFilters(ctx, sc.subjects[key], f, operator); err != nil {
+			return errors.Wrapf(err, "add filters to %s subject failure", key)
+		}
+	}
+
+	for _, scope := range doc.scopes {
+		sc.combineDocScope(scope, AND, doc.conditions[scope])
+	}
+
+	for attr, fields := range doc.state.fields {
+		sc.fields[attr] = fields
+	}
+
+	for i, key := range keys {
+		st := sc.subjects[key]
+
+		for _, scope := range subjects[i].scopes {
+			st.combine(scope, AND, subjects[i].conditions[scope])
+		}
+
+		st.fields = subjects[i].state.fields
+	}
+
+	groups, scopes := groupFiltersByScope(f, sc.docState().filterScope)
+
+	for _, scope := range scopes {
+		for _, f := range groups[scope] {
+			sc.filtered[scopedAttr{Scope: scope, Attr: f.Attr}] = true
+		}
+	}
 
 	return nil
 }
 
-func (sc *SqlBuilder) applyPipelines(filters []Filter, operator LogicOperator) (stmt ConditionStmt, err error) {
+// Conditions of the filters compiled for a state, they are combined to the state after all states compiled
+type compiledFilters struct {
+	state      *subjectState
+	conditions map[string]ConditionStmt
+	scopes     []string
+}
+
+// Compile the filters with the pipelines of state, fields expanded are put to the clone of state
+func (sc *SqlBuilder) compileFilters(ctx context.Context, st *subjectState, f []Filter, operator LogicOperator) (*compiledFilters, error) {
+	var owned []Filter
+
+	for _, filter := range f {
+		if _, ok := st.pipelines[filter.Attr]; ok || !sc.isSubjectPipelineAttr(filter.Attr) {
+			owned = append(owned, filter)
+		}
+	}
+
+	c := &compiledFilters{state: st.clone(), conditions: map[string]ConditionStmt{}}
+	groups, scopes := groupFiltersByScope(owned, st.filterScope)
+
+	for _, scope := range scopes {
+		condition, err := sc.applyPipelines(ctx, c.state, groups[scope], operator)
+
+		if err != nil {
+			return nil, err
+		}
+
+		c.conditions[scope] = condition
+		c.scopes = append(c.scopes, scope)
+	}
+
+	return c, nil
+}
+
+// The attr is the pipeline of some subject, but not of the doc
+func (sc *SqlBuilder) isSubjectPipelineAttr(attr string) bool {
+	if _, ok := sc.Doc.Composition.FilterPipelines[attr]; ok {
+		return false
+	}
+
+	for _, def := range sc.Doc.Composition.Subject {
+		if _, ok := def.FilterPipelines[attr]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Group filters by scope, scope names are returned in sorted order
+func groupFiltersByScope(filters []Filter, scopeOf func(f Filter) string) (map[string][]Filter, []string) {
+	groups := make(map[string][]Filter)
+	var names []string
+
+	for _, f := range filters {
+		scope := scopeOf(f)
+		if _, ok := groups[scope]; !ok {
+			names = append(names, scope)
+		}
+		groups[scope] = append(groups[scope], f)
+	}
+
+	sort.Strings(names)
+
+	return groups, names
+}
+
+func (sc *SqlBuilder) applyPipelines(ctx context.Context, st *subjectState, filters []Filter, operator LogicOperator) (stmt ConditionStmt, err error) {
+	return sc.applyPipelinesPath(ctx, st, filters, operator, nil)
+}
+
+func (sc *SqlBuilder) applyPipelinesPath(ctx context.Context, st *subjectState, filters []Filter, operator LogicOperator, path []string) (stmt ConditionStmt, err error) {
 	var restFilters []Filter
 
 	for _, f := range filters {
 		contains := false
-		for k := range sc.Doc.Composition.FilterPipelines {
+		for k := range st.pipelines {
 			if f.Attr == k {
 				contains = true
 			}
@@ -176,38 +604,202 @@ func (sc *SqlBuilder) applyPipelines(filters []Filter, operator LogicOperator) (
 		}
 	}
 
-	stmt, err = Conditions(&restFilters, operator)
+	plainFilters, related := sc.groupRelationFilters(restFilters)
+
+	stmt, err = sc.conditionBuilder().Conditions(&plainFilters, operator)
+
+	if err == nil && len(related) > 0 {
+		stmt, err = sc.combineRelations(stmt, related, operator)
+	}
 
-	if len(restFilters) == len(filters) {
+	if len(restFilters) == len(filters) || err != nil {
 		return stmt, err
 	}
 
-	for _, f := range filters {
-		for attr, p := range sc.Doc.Composition.FilterPipelines {
+	for _, attr := range st.pipelineAttrs() {
+		p := st.pipelines[attr]
+
+		for _, f := range filters {
 			if f.Attr != attr {
 				continue
 			}
-			if gen, ok := sc.pipelines[p.Type]; ok {
-				expander := gen(p.Params)
-				subStmt, err := expander.Expand(f)
 
-				if err != nil {
-					return stmt, fmt.Errorf("%s attr expend failure", attr)
-				}
+			subStmt, err := sc.applyPipeline(ctx, st, attr, p, f, path)
+
+			if err != nil {
+				return stmt, err
+			}
+
+			// filters emitted by rewriter are combined by the operator of group
+			op := p.combineOp()
+			if len(path) > 0 {
+				op = operator
+			}
+
+			stmt = Combine(op, subStmt, stmt)
+		}
+	}
+
+	return stmt, nil
+}
+
+// Apply the pipeline to the filter, filters emitted by rewriter go through the pipelines again, path is the attrs
+// of pipelines rewrote the filter, which is used to detect the cycle
+func (sc *SqlBuilder) applyPipeline(ctx context.Context, st *subjectState, attr string, p FilterPipelineDefinition, f Filter, path []string) (ConditionStmt, error) {
+	gen := sc.expanderGenerator(p.Type)
+
+	if gen == nil {
+		return ConditionStmt{}, fmt.Errorf("%s pipline type not registered", p.Type)
+	}
+
+	expander := gen(p.Params)
+
+	if expander == nil {
+		return ConditionStmt{}, fmt.Errorf("%s pipeline generate expander failure", attr)
+	}
+
+	if rw, ok := expander.(FilterRewriter); ok {
+		return sc.rewrite(ctx, st, attr, rw, f, path)
+	}
+
+	memo, _ := ctx.Value(pipelineMemoKey{}).(pipelineMemo)
+	key := fmt.Sprintf("%s|%#v|%#v", attr, p, f)
+
+	r, ok := memo[key]
+
+	if !ok {
+		stmt, err := sc.expand(ctx, expander, f)
+
+		if err != nil {
+			return stmt, errors.Wrapf(err, "%s attr expend failure", attr)
+		}
 
-				stmt = CombineAnd(subStmt, stmt)
-			} else {
-				return stmt, fmt.Errorf("%s pipline type not registered", p.Type)
+		r = expandedPipeline{stmt: stmt}
+
+		if _, ok := expander.(FieldExpander); ok {
+			if r.fields, err = sc.expandFields(ctx, expander, f); err != nil {
+				return stmt, errors.Wrapf(err, "%s attr fields expend failure", attr)
 			}
 		}
+
+		if memo != nil {
+			memo[key] = r
+		}
+	}
+
+	if !r.fields.IsEmpty() {
+		fields := r.fields.Clone()
+		st.fields[attr] = &fields
 	}
 
-	return stmt, err
+	return r.stmt.Clone(), nil
+}
+
+// Key of the pipeline memo in context
+type pipelineMemoKey struct{}
+
+// Pipelines expanded by one adding of filters, keyed by the attr, definition and filter, so that the states of same
+// pipeline do not expand it again, such as the lookup query
+type pipelineMemo map[string]expandedPipeline
+
+type expandedPipeline struct {
+	stmt   ConditionStmt
+	fields ConditionStmt
+}
+
+// Rewrite the filter and build the emitted filters, the emitted filter of the rewriter attr itself is built to
+// plain condition, others go through the pipelines
+func (sc *SqlBuilder) rewrite(ctx context.Context, st *subjectState, attr string, rw FilterRewriter, f Filter, path []string) (ConditionStmt, error) {
+	for _, a := range path {
+		if a == attr {
+			return ConditionStmt{}, fmt.Errorf("pipeline cycle detected: %s", strings.Join(append(path, attr), " -> "))
+		}
+	}
+
+	group, err := rw.Rewrite(f)
+
+	if err != nil {
+		return ConditionStmt{}, errors.Wrapf(err, "%s attr rewrite failure", attr)
+	}
+
+	op := group.LogicOp
+	if op == "" {
+		op = AND
+	}
+
+	var terminal, emitted []Filter
+	for _, ef := range group.Filters {
+		if ef.Attr == attr {
+			terminal = append(terminal, *ef)
+		} else {
+			emitted = append(emitted, *ef)
+		}
+	}
+
+	stmt, err := sc.conditionBuilder().Conditions(&terminal, op)
+
+	if err != nil {
+		return stmt, err
+	}
+
+	if len(emitted) == 0 {
+		return stmt, nil
+	}
+
+	subStmt, err := sc.applyPipelinesPath(ctx, st, emitted, op, append(append([]string{}, path...), attr))
+
+	if err != nil {
+		return stmt, err
+	}
+
+	if stmt.IsEmpty() {
+		return subStmt, nil
+	}
+
+	return Combine(op, stmt, subStmt), nil
+}
+
+// Condition builder of the builder dialect
+func (sc *SqlBuilder) conditionBuilder() ConditionBuilder {
+	return ConditionBuilder{Dialect: sc.Dialect, Attributes: docAttributes(sc.Doc)}
+}
+
+// Expand the filter with the context and builder DB if the expander supports
+func (sc *SqlBuilder) expand(ctx context.Context, expander Expander, f Filter) (ConditionStmt, error) {
+	if ce, ok := expander.(ContextExpander); ok {
+		return ce.ExpandContext(sc.expansionContext(ctx), f)
+	}
+
+	return expander.Expand(f)
+}
+
+// Expand the fields of filter with the context if the field expander supports
+func (sc *SqlBuilder) expandFields(ctx context.Context, expander Expander, f Filter) (ConditionStmt, error) {
+	if ce, ok := expander.(ContextFieldExpander); ok {
+		return ce.ExpandFieldsContext(sc.expansionContext(ctx), f)
+	}
+
+	return expander.(FieldExpander).ExpandFields(f)
+}
+
+func (sc *SqlBuilder) expansionContext(ctx context.Context) ExpansionContext {
+	ec := ExpansionContext{
+		Context:     ctx,
+		Dialect:     sc.Dialect,
+		Attributes:  docAttributes(sc.Doc),
+		User:        sc.User,
+		LookupCache: sc.lookupCache,
+	}
+	if sc.DB != nil {
+		ec.DB = sc.DB
+	}
+
+	return ec
 }
 
 func (sc *SqlBuilder) Limit(offset int64, size int64) *SqlBuilder {
-	sc.limit.Offset = offset
-	sc.limit.Size = size
+	sc.limit = &SqlLimit{Offset: offset, Size: size}
+	sc.limited = true
 	return sc
 }
 
@@ -216,60 +808,280 @@ func (sc *SqlBuilder) OrderBy(ob *OrderBy) *SqlBuilder {
 	return sc
 }
 
-func (sc *SqlBuilder) compose(s string) (string, error) {
+// Clone the builder, the conditions, args, tokens, sort and limit of clone are independent to the builder,
+// the composition doc and db are shared
+func (sc *SqlBuilder) Clone() *SqlBuilder {
+	conditions := sc.Conditions.Clone()
+	orderBy := OrderBy{}
+	if sc.orderBy != nil {
+		orderBy = append(orderBy, *sc.orderBy...)
+	}
+	limit := *sc.limit
+
+	c := &SqlBuilder{
+		DB:         sc.DB,
+		Doc:        sc.Doc,
+		Dialect:    sc.Dialect,
+		User:       sc.User,
+		Conditions: &conditions,
+		scopes:     cloneConditionsMap(sc.scopes),
+		filtered:   make(map[scopedAttr]bool, len(sc.filtered)),
+		removed:    make(map[string]bool, len(sc.removed)),
+		security:   cloneConditionsMap(sc.security),
+		orderBy:    &orderBy,
+		limit:      &limit,
+		tokens:     make(map[string]interface{}, len(sc.tokens)),
+		pipelines:  make(map[string]ExpanderGenerator, len(sc.pipelines)),
+		fields:     cloneConditionsMap(sc.fields),
+		subjects:   make(map[string]*subjectState, len(sc.subjects)),
+		limited:    sc.limited,
+		converters: sc.converters,
+
+		lookupCache: sc.lookupCache,
+	}
+
+	for k, st := range sc.subjects {
+		c.subjects[k] = st.clone()
+	}
+
+	for k, v := range sc.filtered {
+		c.filtered[k] = v
+	}
+
+	for k, v := range sc.removed {
+		c.removed[k] = v
+	}
+
+	for k, v := range sc.tokens {
+		c.tokens[k] = v
+	}
+
+	for k, v := range sc.pipelines {
+		c.pipelines[k] = v
+	}
+
+	return c
+}
+
+// Reset the conditions, sort and limit back to the state of new builder, so only the default conditions apply.
+// Security filters, tokens and pipeline types are kept
+func (sc *SqlBuilder) Reset() *SqlBuilder {
+	sc.Conditions = new(ConditionStmt)
+	sc.scopes = make(map[string]*ConditionStmt)
+	sc.filtered = make(map[scopedAttr]bool)
+	sc.removed = make(map[string]bool)
+	sc.fields = make(map[string]*ConditionStmt)
+	sc.orderBy = new(OrderBy)
+	sc.limit = &SqlLimit{0, 10}
+	sc.limited = false
+
+	for _, st := range sc.subjects {
+		st.reset()
+	}
+
+	return sc
+}
+
+func cloneConditionsMap(m map[string]*ConditionStmt) map[string]*ConditionStmt {
+	c := make(map[string]*ConditionStmt, len(m))
+
+	for k, v := range m {
+		stmt := v.Clone()
+		c[k] = &stmt
+	}
+
+	return c
+}
+
+// Compose the subject, returns the sql and the args of all scopes
+func (sc *SqlBuilder) compose(def SubjectDefinition, st *subjectState) (string, map[string]interface{}, error) {
+	args := make(map[string]interface{})
+	rendered := make(map[string]*bool)
+
+	limit, orderBy := sc.limit, sc.orderBy
+	if !sc.limited && def.Limit > 0 {
+		limit = &SqlLimit{Offset: 0, Size: def.Limit}
+	}
+	if (orderBy == nil || orderBy.IsEmpty()) && !def.DefaultSort.IsEmpty() {
+		orderBy = &def.DefaultSort
+	}
+
 	tks := map[string]interface{}{
-		"where":    sc.Conditions,
-		"having":   sc.Conditions,
-		"limit":    sc.limit,
-		"order_by": sc.orderBy,
+		"limit":    limit,
+		"order_by": orderBy,
+	}
+
+	// conditions of every scope, args are renamed to keep unique between scopes
+	for _, scope := range append([]string{""}, sc.subjectScopes(def, st)...) {
+		stmt, err := sc.effectiveConditions(scope, def, st)
+
+		if err != nil {
+			return "", nil, err
+		}
+
+		stmt = rebaseArgs(stmt, args)
+		for k, v := range stmt.Arg {
+			args[k] = v
+		}
+
+		security := rebaseArgs(*sc.SecurityConditions(scope), args)
+		for k, v := range security.Arg {
+			args[k] = v
+		}
+
+		where, having := "where", "having"
+		if scope != "" {
+			where, having = where+"."+scope, having+"."+scope
+		}
+
+		rendered[scope] = new(bool)
+		tks[where] = ConditionToken{Keyword: "WHERE", Stmt: stmt, Security: security, rendered: rendered[scope]}
+		tks[having] = ConditionToken{Keyword: "HAVING", Stmt: stmt, Security: security}
+	}
+
+	// fields exposed by pipelines
+	for attr, p := range st.pipelines {
+		if fields, ok := st.fields[attr]; ok {
+			stmt := rebaseArgs(*fields, args)
+			for k, v := range stmt.Arg {
+				args[k] = v
+			}
+
+			tks["fields."+attr] = stmt.Clause
+			continue
+		}
+
+		if gen := sc.expanderGenerator(p.Type); gen != nil {
+			if fe, ok := gen(p.Params).(FieldExpander); ok && fe.DefaultFields() != "" {
+				tks["fields."+attr] = fe.DefaultFields()
+			}
+		}
 	}
 
 	// fields context process
 	for k, g := range sc.Doc.Composition.Fields {
-		tks["fields."+k] = g
+		tks["fields."+k] = sc.conditionBuilder().fieldGroup(g)
 	}
 
 	for k, v := range sc.tokens {
 		tks[k] = v
 	}
 
-	return tokenReplace(s, tks)
+	rs, err := tokenReplace(def.SQL, tks)
+
+	if err != nil {
+		return rs, args, err
+	}
+
+	return rs, args, sc.checkSecurityRendered(rendered)
+}
+
+// Scopes used by the subject and scopes with conditions, in sorted order
+func (sc *SqlBuilder) subjectScopes(def SubjectDefinition, st *subjectState) []string {
+	set := make(map[string]bool)
+
+	for k := range st.scopes {
+		if k != "" {
+			set[k] = true
+		}
+	}
+
+	for _, dc := range def.defaultConditions(sc.Doc) {
+		if dc.Scope != "" {
+			set[dc.Scope] = true
+		}
+	}
+
+	for k := range sc.security {
+		if k != "" {
+			set[k] = true
+		}
+	}
+
+	for _, placeholder := range CollectTokenPlaceholder(def.SQL) {
+		ss := strings.SplitN(placeholder[1], ".", 2)
+		if len(ss) == 2 && conditionKeyword(ss[0]) != "" {
+			set[ss[1]] = true
+		}
+	}
+
+	scopes := make([]string, 0, len(set))
+	for k := range set {
+		scopes = append(scopes, k)
+	}
+	sort.Strings(scopes)
+
+	return scopes
 }
 
 // Build query statement
 func (sc *SqlBuilder) Rebind(key string) (string, []interface{}, error) {
-	if s, ok := sc.Doc.Composition.Subject[key]; ok {
-		subject, err := sc.compose(s)
+	bindType := sqlx.UNKNOWN
+	if sc.DB != nil {
+		bindType = sqlx.BindType(sc.DB.DriverName())
+	}
 
-		if err != nil {
-			return "", nil, errors.Wrap(err, "sql compose failure")
+	return sc.rebind(key, bindType)
+}
+
+// Build query statement with the bind var type
+func (sc *SqlBuilder) rebind(key string, bindType int) (string, []interface{}, error) {
+	if def, ok := sc.Doc.Composition.Subject[key]; ok {
+		st, ok := sc.subjects[key]
+		if !ok {
+			st = sc.docState()
 		}
 
-		query, args, err := sqlx.Named(subject, sc.Conditions.Arg)
+		subject, arg, err := sc.compose(def, st)
 
 		if err != nil {
-			return query, nil, errors.Wrap(err, "Named failure")
+			return "", nil, errors.Wrap(err, "sql compose failure")
 		}
 
-		reg := regexp.MustCompile(`IN\(:\w+\)`)
-		if reg.MatchString(subject) {
-			query, args, err = sqlx.In(query, args...)
+		return bindNamed(subject, arg, bindType)
+	}
 
-			if err != nil {
-				return query, nil, errors.Wrap(err, "IN sql rebind failure")
-			}
-		}
+	return "", nil, fmt.Errorf("key name %s not exists in composition doc", key)
+}
+
+// Bind the named args of query, slice args of IN are expanded, bind vars follow the bind type
+func bindNamed(subject string, arg map[string]interface{}, bindType int) (string, []interface{}, error) {
+	query, args, err := sqlx.Named(subject, arg)
+
+	if err != nil {
+		return query, nil, errors.Wrap(err, "Named failure")
+	}
+
+	reg := regexp.MustCompile(`IN\s*\(:\w+\)`)
+	if reg.MatchString(subject) {
+		query, args, err = sqlx.In(query, args...)
 
-		query = sc.DB.Rebind(query)
-		return query, args, nil
+		if err != nil {
+			return query, nil, errors.Wrap(err, "IN sql rebind failure")
+		}
 	}
 
-	return "", nil, fmt.Errorf("key name %s not exists in composition doc", key)
+	query = sqlx.Rebind(bindType, query)
+	return query, args, nil
 }
 
-// Result row type convert
+// Result row type convert, the row converters of doc pipelines apply
 // TODO support custom type
 func (sc *SqlBuilder) RowConvert(row *map[string]interface{}) {
+	sc.convertRow(row, sc.converters[""])
+}
+
+// Result row of the subject convert, the row converters of the pipelines of subject apply
+func (sc *SqlBuilder) RowConvertSubject(key string, row *map[string]interface{}) {
+	rcs, ok := sc.converters[key]
+	if !ok {
+		rcs = sc.converters[""]
+	}
+
+	sc.convertRow(row, rcs)
+}
+
+func (sc *SqlBuilder) convertRow(row *map[string]interface{}, rcs []RowConverter) {
 	fs := SqlCompositionFieldGroup{}
 
 	for _, fields := range sc.Doc.Composition.Fields {
@@ -287,4 +1099,45 @@ func (sc *SqlBuilder) RowConvert(row *map[string]interface{}) {
 			}
 		}
 	}
+
+	for _, rc := range rcs {
+		rc.ConvertRow(row)
+	}
+}
+
+// Build the row converters of the doc and subject pipelines once, they are rebuilt when a generator registered
+func (sc *SqlBuilder) buildRowConverters() {
+	converters := map[string][]RowConverter{"": sc.rowConverters(sc.Doc.Composition.FilterPipelines)}
+
+	for key, st := range sc.subjects {
+		converters[key] = sc.rowConverters(st.pipelines)
+	}
+
+	sc.converters = converters
+}
+
+// Row converters of the pipelines in attr order
+func (sc *SqlBuilder) rowConverters(pipelines map[string]FilterPipelineDefinition) []RowConverter {
+	var rcs []RowConverter
+
+	attrs := make([]string, 0, len(pipelines))
+	for attr := range pipelines {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+
+	for _, attr := range attrs {
+		p := pipelines[attr]
+		gen := sc.expanderGenerator(p.Type)
+
+		if gen == nil {
+			continue
+		}
+
+		if rc, ok := gen(p.Params).(RowConverter); ok {
+			rcs = append(rcs, rc)
+		}
+	}
+
+	return rcs
 }
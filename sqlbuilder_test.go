@@ -554,3 +554,193 @@ composition:
 }
 
 
+
+func TestSqlBuilder_FilterScope(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  filterPipelines:
+    consume:
+      type: fulltext
+      scope: outer
+      params:
+        - name: fields
+          value:
+            - consume_total
+  fields:
+    base:
+      - name: name
+        expr: users.name
+      - name: age
+        expr: users.age
+    statistic:
+      - name: consume_total
+        expr: SUM(orders.total_amount)
+  defaultConditions:
+    - attr: users.age
+      op: ">"
+      val: 18
+      scope: inner
+  subject:
+    list: "SELECT t.name, t.consume_total FROM (SELECT %fields.base, %fields.statistic FROM users LEFT JOIN orders ON orders.uid = users.uid %where.inner GROUP BY users.uid) t %where.outer ORDER BY t.name"
+    total: "SELECT count(*) FROM (SELECT users.uid FROM users %where.inner{users_name}) t"`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.RegisterPipelineType("fulltext")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: "o", Op: Contains, Attr: "users.name", Scope: "inner"},
+			{Val: 100, Op: Greater, Attr: "t.consume_total", Scope: "outer"},
+			{Val: "9", Op: Contains, Attr: "consume"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "", sb.Conditions.Clause)
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT t.name, t.consume_total FROM (SELECT users.name AS name, users.age AS age, "+
+			"SUM(orders.total_amount) AS consume_total FROM users LEFT JOIN orders ON orders.uid = users.uid "+
+			"WHERE (users.age > ?) AND ((users.name LIKE ?)) GROUP BY users.uid) t "+
+			"WHERE ((consume_total LIKE ?) AND (t.consume_total > ?)) ORDER BY t.name", q)
+		assert.Equal(t, []interface{}{18, "%o%", "%9%", 100}, a)
+
+		rows, err := db.Queryx(q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for rows.Next() {
+			row := make(map[string]interface{})
+			if err = rows.MapScan(row); err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, row["name"].(string))
+		}
+
+		assert.Equal(t, []string{"Scott"}, names)
+
+		q, a, err = sb.Rebind("total")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT count(*) FROM (SELECT users.uid FROM users WHERE ((users.name LIKE ?))) t", q)
+		assert.Equal(t, []interface{}{"%o%"}, a)
+	})
+}
+
+func TestSqlBuilder_CloneAndReset(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  fields:
+    base:
+      - name: name
+        expr: users.name
+      - name: age
+        expr: users.age
+  defaultConditions:
+    - attr: users.age
+      op: ">"
+      val: 10
+  subject:
+    list: "SELECT %fields.base FROM users %where %order_by %limit"`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		base, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = base.AddFilters([]Filter{
+			{Val: []int{1, 2}, Op: In, Attr: "users.uid"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		base.OrderBy(&OrderBy{{Name: "age", Direction: DESC}}).Limit(0, 5)
+
+		branch := base.Clone()
+
+		err = branch.AddFilters([]Filter{
+			{Val: "Barry", Op: Equal, Attr: "users.name"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		branch.Limit(5, 5)
+		branch.Conditions.Arg["users_uid"].([]int)[0] = 3
+
+		q, a, err := base.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name, users.age AS age FROM users "+
+			"WHERE (users.age > ?) AND ((users.uid IN(?, ?))) ORDER BY age DESC LIMIT 0, 5", q)
+		assert.Equal(t, []interface{}{10, 1, 2}, a)
+
+		q, a, err = branch.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name, users.age AS age FROM users "+
+			"WHERE (users.age > ?) AND (((users.uid IN(?, ?))) AND (users.name = ?)) ORDER BY age DESC LIMIT 5, 5", q)
+		assert.Equal(t, []interface{}{10, 3, 2, "Barry"}, a)
+
+		q, a, err = branch.Reset().Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name, users.age AS age FROM users WHERE users.age > ?  LIMIT 0, 10", q)
+		assert.Equal(t, []interface{}{10}, a)
+
+		q, _, err = base.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name, users.age AS age FROM users "+
+			"WHERE (users.age > ?) AND ((users.uid IN(?, ?))) ORDER BY age DESC LIMIT 0, 5", q)
+	})
+}
@@ -0,0 +1,152 @@
+package sqlcomposer
+
+import "sort"
+
+// SubjectDefinition is the sql of subject and the settings only apply to it, the plain string form is the sql
+//
+//	subject:
+//	  export: "SELECT %fields.base FROM users %where"
+//	  list:
+//	    sql: "SELECT %fields.base FROM users %where %order_by %limit"
+//	    defaultConditions:
+//	      - attr: users.status
+//	        op: "<>"
+//	        val: deleted
+//	    filterPipelines:
+//	      keyword:
+//	        type: fulltext
+//	        params:
+//	          - name: fields
+//	            value: [users.name]
+//	    defaultSort:
+//	      - name: users.uid
+//	        direction: DESC
+//	    limit: 20
+//
+// Default conditions are applied with the default conditions of doc, pipelines override the doc pipelines of
+// same attr, default sort and limit apply when the builder has no sort or limit
+type SubjectDefinition struct {
+	SQL               string                              `yaml:"sql"`
+	DefaultConditions []DefaultCondition                  `yaml:"defaultConditions,omitempty"`
+	FilterPipelines   map[string]FilterPipelineDefinition `yaml:"filterPipelines,omitempty"`
+	DefaultSort       OrderBy                             `yaml:"defaultSort,omitempty"`
+	Limit             int64                               `yaml:"limit,omitempty"`
+}
+
+// Implement yaml unmarshaler, the subject could be the sql string
+func (def *SubjectDefinition) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&def.SQL); err == nil {
+		return nil
+	}
+
+	type plain SubjectDefinition
+	return unmarshal((*plain)(def))
+}
+
+// Default conditions of doc and the subject
+func (def SubjectDefinition) defaultConditions(doc *SqlApiDoc) []DefaultCondition {
+	dcs := make([]DefaultCondition, 0, len(doc.Composition.DefaultConditions)+len(def.DefaultConditions))
+	dcs = append(dcs, doc.Composition.DefaultConditions...)
+
+	return append(dcs, def.DefaultConditions...)
+}
+
+// Conditions and fields of filters compiled with the pipelines, scope "" is the conditions of %where
+type subjectState struct {
+	pipelines map[string]FilterPipelineDefinition
+	scopes    map[string]*ConditionStmt
+	fields    map[string]*ConditionStmt
+}
+
+// State of the subject has its own pipelines, the subject pipelines override the doc pipelines of same attr
+func newSubjectState(doc, subject map[string]FilterPipelineDefinition) *subjectState {
+	pipelines := make(map[string]FilterPipelineDefinition, len(doc)+len(subject))
+
+	for k, v := range doc {
+		pipelines[k] = v
+	}
+
+	for k, v := range subject {
+		pipelines[k] = v
+	}
+
+	return &subjectState{
+		pipelines: pipelines,
+		scopes:    make(map[string]*ConditionStmt),
+		fields:    make(map[string]*ConditionStmt),
+	}
+}
+
+// State of the doc pipelines, the maps are shared with builder
+func (sc *SqlBuilder) docState() *subjectState {
+	scopes := map[string]*ConditionStmt{"": sc.Conditions}
+
+	for k, v := range sc.scopes {
+		scopes[k] = v
+	}
+
+	return &subjectState{
+		pipelines: sc.Doc.Composition.FilterPipelines,
+		scopes:    scopes,
+		fields:    sc.fields,
+	}
+}
+
+func (st *subjectState) conditions(scope string) ConditionStmt {
+	if c, ok := st.scopes[scope]; ok {
+		return *c
+	}
+
+	return ConditionStmt{}
+}
+
+func (st *subjectState) combine(scope string, op LogicOperator, c ConditionStmt) {
+	combined := Combine(op, st.conditions(scope), c)
+	st.scopes[scope] = &combined
+}
+
+func (st *subjectState) filterScope(f Filter) string {
+	if p, ok := st.pipelines[f.Attr]; ok && p.Scope != "" {
+		return p.Scope
+	}
+
+	return f.Scope
+}
+
+// Attrs of pipelines sorted, so that the conditions are combined in the stable order
+func (st *subjectState) pipelineAttrs() []string {
+	attrs := make([]string, 0, len(st.pipelines))
+
+	for attr := range st.pipelines {
+		attrs = append(attrs, attr)
+	}
+
+	sort.Strings(attrs)
+
+	return attrs
+}
+
+func (st *subjectState) clone() *subjectState {
+	return &subjectState{
+		pipelines: st.pipelines,
+		scopes:    cloneConditionsMap(st.scopes),
+		fields:    cloneConditionsMap(st.fields),
+	}
+}
+
+func (st *subjectState) reset() {
+	st.scopes = make(map[string]*ConditionStmt)
+	st.fields = make(map[string]*ConditionStmt)
+}
+
+func sortedSubjectKeys(m map[string]*subjectState) []string {
+	keys := make([]string, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
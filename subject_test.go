@@ -0,0 +1,234 @@
+package sqlcomposer
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSqlBuilder_SubjectDefinition(t *testing.T) {
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  filterPipelines:
+    keyword:
+      type: fulltext
+      params:
+        - name: fields
+          value: [users.name]
+  fields:
+    base:
+      - name: name
+        expr: users.name
+  subject:
+    export: "SELECT %fields.base FROM users %where %order_by"
+    list:
+      sql: "SELECT %fields.base FROM users %where %order_by %limit"
+      defaultConditions:
+        - attr: users.age
+          op: ">"
+          val: 20
+      filterPipelines:
+        keyword:
+          type: fulltext
+          params:
+            - name: fields
+              value: [users.name, users.nickname]
+      defaultSort:
+        - name: users.uid
+          direction: DESC
+      limit: 2`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users WHERE users.age > ? ORDER BY users.uid DESC LIMIT 0, 2", q)
+		assert.Equal(t, []interface{}{20}, a)
+
+		var names []string
+		err = db.Select(&names, q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"Zoe", "Barry"}, names)
+
+		err = sb.AddFilters([]Filter{
+			{Val: "o", Op: Contains, Attr: "keyword"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sb.Limit(0, 10)
+
+		q, _, err = sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users WHERE (users.age > ?) AND "+
+			"(((users.name LIKE ? OR users.nickname LIKE ?))) ORDER BY users.uid DESC LIMIT 0, 10", q)
+
+		q, _, err = sb.Rebind("export")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users WHERE ((users.name LIKE ?))", q)
+
+		sb.OrderBy(&OrderBy{{Name: "users.name", Direction: ASC}})
+
+		q, _, err = sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users WHERE (users.age > ?) AND "+
+			"(((users.name LIKE ? OR users.nickname LIKE ?))) ORDER BY users.name ASC LIMIT 0, 10", q)
+
+		sb.Reset()
+
+		q, _, err = sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users WHERE users.age > ? ORDER BY users.uid DESC LIMIT 0, 2", q)
+	})
+
+	_, err := NewSqlBuilder(nil, []byte(`
+composition:
+  subject:
+    list:
+      sql: "SELECT * FROM users %where"
+      filterPipelines:
+        keyword:
+          type: unknown`))
+
+	assert.Error(t, err)
+}
+
+// countExpander count the expanding of filters
+type countExpander struct {
+	count *int
+}
+
+func (e *countExpander) Expand(origFilter Filter) (ConditionStmt, error) {
+	*e.count++
+
+	return WhereAnd(&[]Filter{{Attr: "users.age", Op: origFilter.Op, Val: origFilter.Val}})
+}
+
+func TestSqlBuilder_SubjectPipelines(t *testing.T) {
+	var sqlComposition = `
+composition:
+  filterPipelines:
+    age:
+      type: test_count
+  subject:
+    other: "SELECT users.name FROM users %where"
+    list:
+      sql: "SELECT users.name FROM users %where"
+      filterPipelines:
+        kw:
+          type: fulltext
+          params:
+            - name: fields
+              value: [users.name]
+    export:
+      sql: "SELECT users.name FROM users %where"
+      filterPipelines:
+        lk:
+          type: lookup
+          params:
+            - name: attr
+              value: users.uid
+            - name: query
+              value: "SELECT uid FROM orders %where"
+            - name: match
+              value: orders.status`
+
+	count := 0
+	sb, err := NewSqlBuilder(nil, []byte(sqlComposition), WithExpanderGenerators(map[string]ExpanderGenerator{
+		"test_count": func(ps FilterPipelineParams) Expander {
+			return &countExpander{count: &count}
+		},
+	}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sb.AddFilters([]Filter{
+		{Val: 20, Op: Greater, Attr: "age"},
+		{Val: "o", Op: Contains, Attr: "kw"},
+	}, AND)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the pipeline is expanded once for the doc and subjects
+	assert.Equal(t, 1, count)
+
+	q, _, err := sb.Rebind("list")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, q, "users.name LIKE ?")
+
+	// the pipeline of list is not applied to other subjects
+	for _, key := range []string{"other", "export"} {
+		q, a, err := sb.Rebind(key)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name FROM users WHERE ((users.age > ?))", q)
+		assert.Equal(t, []interface{}{20}, a)
+	}
+
+	// nothing is added when the pipeline of a subject fails
+	sb.Reset()
+
+	err = sb.AddFilters([]Filter{
+		{Val: 20, Op: Greater, Attr: "age"},
+		{Val: 1, Op: Equal, Attr: "lk"},
+	}, AND)
+	assert.Error(t, err)
+	assert.True(t, sb.Conditions.IsEmpty())
+
+	for _, key := range []string{"other", "list", "export"} {
+		q, _, err := sb.Rebind(key)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name FROM users", q)
+	}
+}
@@ -0,0 +1,192 @@
+package sqlcomposer
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	synonymFilesMu sync.Mutex
+	synonymFiles   = map[string][][]string{}
+)
+
+// SynonymsExpander rewrite the text filter to the OR of filters on Attr over all synonyms of the value, so that
+// Attr could be a like or fulltext pipeline
+//
+//	filterPipelines:
+//	  q:
+//	    type: synonyms
+//	    params:
+//	      - name: attr
+//	        value: keyword
+//	      - name: synonyms
+//	        value:
+//	          - [tee, t-shirt]
+//	          - [sofa, couch]
+//
+// The synonyms could be loaded from the yaml file of same format by the file param instead, values are matched
+// case insensitively, negative operators combine the filters by AND
+type SynonymsExpander struct {
+	Attr     string
+	Synonyms [][]string
+}
+
+// Expand the synonyms in the syntax of MySQL, use ExpandContext for the dialect of builder
+func (e *SynonymsExpander) Expand(origFilter Filter) (ConditionStmt, error) {
+	return e.expandConditions(ConditionBuilder{Dialect: MySQL}, origFilter)
+}
+
+func (e *SynonymsExpander) ExpandContext(ec ExpansionContext, origFilter Filter) (ConditionStmt, error) {
+	return e.expandConditions(ec.ConditionBuilder(), origFilter)
+}
+
+func (e *SynonymsExpander) expandConditions(cb ConditionBuilder, origFilter Filter) (ConditionStmt, error) {
+	group, err := e.Rewrite(origFilter)
+
+	if err != nil {
+		return ConditionStmt{}, err
+	}
+
+	var filters []Filter
+	for _, f := range group.Filters {
+		filters = append(filters, *f)
+	}
+
+	return cb.Conditions(&filters, group.LogicOp)
+}
+
+// Implement targeted rewriter, the filters are emitted to Attr
+func (e *SynonymsExpander) RewriteTargets() []string {
+	return []string{e.Attr}
+}
+
+func (e *SynonymsExpander) Rewrite(origFilter Filter) (FilterGroup, error) {
+	group := FilterGroup{LogicOp: OR}
+
+	switch origFilter.Op {
+	case NotEqual, NotIn:
+		group.LogicOp = AND
+	}
+
+	rv := reflect.ValueOf(origFilter.Val)
+
+	// list values are expanded in place
+	if rv.Kind() == reflect.Slice {
+		var vals []interface{}
+		for i := 0; i < rv.Len(); i++ {
+			for _, s := range e.expand(rv.Index(i).Interface()) {
+				vals = append(vals, s)
+			}
+		}
+
+		group.Filters = []*Filter{{Attr: e.Attr, Op: origFilter.Op, Val: vals}}
+		return group, nil
+	}
+
+	for _, s := range e.expand(origFilter.Val) {
+		group.Filters = append(group.Filters, &Filter{Attr: e.Attr, Op: origFilter.Op, Val: s})
+	}
+
+	return group, nil
+}
+
+// The value followed by its synonyms, non string value is not expanded
+func (e *SynonymsExpander) expand(v interface{}) []interface{} {
+	s, ok := v.(string)
+
+	if !ok {
+		return []interface{}{v}
+	}
+
+	res := []interface{}{s}
+	seen := map[string]bool{strings.ToLower(s): true}
+
+	for _, words := range e.Synonyms {
+		if !containsFold(words, s) {
+			continue
+		}
+
+		for _, w := range words {
+			if !seen[strings.ToLower(w)] {
+				seen[strings.ToLower(w)] = true
+				res = append(res, w)
+			}
+		}
+	}
+
+	return res
+}
+
+func containsFold(words []string, s string) bool {
+	for _, w := range words {
+		if strings.EqualFold(w, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Synonyms of the yaml param value, nil if it is invalid
+func synonymsOf(v interface{}) [][]string {
+	list, ok := v.([]interface{})
+
+	if !ok || len(list) == 0 {
+		return nil
+	}
+
+	var synonyms [][]string
+
+	for _, item := range list {
+		words, ok := item.([]interface{})
+
+		if !ok || len(words) < 2 {
+			return nil
+		}
+
+		var ws []string
+		for _, w := range words {
+			ws = append(ws, fmt.Sprint(w))
+		}
+
+		synonyms = append(synonyms, ws)
+	}
+
+	return synonyms
+}
+
+// Load the synonyms from yaml file, files are loaded once
+func loadSynonymsFile(path string) ([][]string, error) {
+	synonymFilesMu.Lock()
+	defer synonymFilesMu.Unlock()
+
+	if s, ok := synonymFiles[path]; ok {
+		return s, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "synonyms file read failure")
+	}
+
+	var v []interface{}
+	if err = yaml.Unmarshal(b, &v); err != nil {
+		return nil, errors.Wrap(err, "synonyms file unmarshal failure")
+	}
+
+	s := synonymsOf(v)
+
+	if s == nil {
+		return nil, fmt.Errorf("synonyms file %s is invalid", path)
+	}
+
+	synonymFiles[path] = s
+
+	return s, nil
+}
@@ -0,0 +1,130 @@
+package sqlcomposer
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSynonymsExpander(t *testing.T) {
+	dir, err := ioutil.TempDir("", "synonyms")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "synonyms.yaml")
+	err = ioutil.WriteFile(file, []byte("- [zoe, zoey]\n"), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sqlComposition = `
+info:
+  name: example
+  version: 1.0.0
+composition:
+  filterPipelines:
+    q:
+      type: synonyms
+      params:
+        - name: attr
+          value: keyword
+        - name: synonyms
+          value:
+            - [bob, barry]
+    keyword:
+      type: fulltext
+      params:
+        - name: fields
+          value: [users.name]
+    users.name:
+      type: synonyms
+      params:
+        - name: attr
+          value: users.name
+        - name: file
+          value: ` + file + `
+  fields:
+    base:
+      - name: name
+        expr: users.name
+  subject:
+    list: "SELECT %fields.base FROM users %where ORDER BY users.uid"`
+
+	RunWithSchema(defaultSchema, t, func(db *sqlx.DB, t *testing.T) {
+		loadDefaultFixture(db, t)
+
+		sb, err := NewSqlBuilder(db, []byte(sqlComposition))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sb.AddFilters([]Filter{
+			{Val: "Bob", Op: Contains, Attr: "q"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err := sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []interface{}{"%barry%", "%Bob%"}, a)
+
+		var names []string
+		err = db.Select(&names, q, a...)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []string{"Barry"}, names)
+
+		sb.Reset()
+		err = sb.AddFilters([]Filter{
+			{Val: "Zoey", Op: Equal, Attr: "users.name"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		q, a, err = sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "SELECT users.name AS name FROM users "+
+			"WHERE ((users.name = ? OR users.name = ?)) ORDER BY users.uid", q)
+		assert.Equal(t, []interface{}{"Zoey", "zoe"}, a)
+
+		sb.Reset()
+		err = sb.AddFilters([]Filter{
+			{Val: []string{"zoe", "scott"}, Op: NotIn, Attr: "users.name"},
+		}, AND)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, a, err = sb.Rebind("list")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, []interface{}{"zoe", "zoey", "scott"}, a)
+	})
+}
@@ -51,6 +51,40 @@ func (fs ConditionStmt) IsEmpty() bool {
 	return fs.Clause == ""
 }
 
+// Deep copy of the statement, slice args are copied too
+func (fs ConditionStmt) Clone() ConditionStmt {
+	c := ConditionStmt{Clause: fs.Clause}
+
+	if fs.Arg != nil {
+		c.Arg = make(map[string]interface{}, len(fs.Arg))
+		for k, v := range fs.Arg {
+			c.Arg[k] = cloneArg(v)
+		}
+	}
+
+	if fs.ClauseSlice != nil {
+		c.ClauseSlice = make(map[string]string, len(fs.ClauseSlice))
+		for k, v := range fs.ClauseSlice {
+			c.ClauseSlice[k] = v
+		}
+	}
+
+	return c
+}
+
+func cloneArg(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+
+	if rv.Kind() != reflect.Slice || rv.IsNil() {
+		return v
+	}
+
+	c := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+	reflect.Copy(c, rv)
+
+	return c.Interface()
+}
+
 // Implement token replacer
 func (fs ConditionStmt) TokenReplace(ctx map[string]interface{}) string {
 	if !fs.IsEmpty() {
@@ -61,7 +95,7 @@ func (fs ConditionStmt) TokenReplace(ctx map[string]interface{}) string {
 }
 
 func removeCondition(s string, c string) (res string) {
-	rc := strings.ReplaceAll(strings.ReplaceAll(c, "(", "\\("), ")", "\\)")
+	rc := regexp.QuoteMeta(c)
 
 	l := regexp.MustCompile(fmt.Sprintf(`\s+(AND|OR)?\s+(\(%s\)|%s)`, rc, rc))
 	r := regexp.MustCompile(fmt.Sprintf(`(\(%s\)|%s)\s+(AND|OR)?\s+`, rc, rc))
@@ -90,59 +124,64 @@ func removeCondition(s string, c string) (res string) {
 
 // Implement token replacer
 func (fs ConditionStmt) TokenReplaceWithParams(params string, token string) string {
-	if !fs.IsEmpty() {
-		include, fields := processConditionsParameters(params)
+	clauses := fs.paramsClause(params)
 
-		if len(fields) == 0 {
-			return fmt.Sprintf("WHERE %s", fs.Clause)
-		}
+	if len(clauses) == 0 {
+		return ""
+	}
 
-		clauses := fs.Clause
+	if kw := conditionKeyword(token); kw != "" {
+		return fmt.Sprintf("%s %s", kw, clauses)
+	}
 
-		excluded := make([]string, 0)
+	return ""
+}
 
-		for k, _ := range fs.ClauseSlice {
-			in := false
-			for _, f := range fields {
-				if f == k {
-					in = true
-					break
-				}
-			}
+// The clause remained after the include or exclude token params applied
+func (fs ConditionStmt) paramsClause(params string) string {
+	if fs.IsEmpty() {
+		return ""
+	}
 
-			if !in {
-				excluded = append(excluded, k)
-			}
-		}
+	include, fields := processConditionsParameters(params)
 
-		if include {
-			for _, f := range excluded {
-				if cs, ok := fs.ClauseSlice[f]; ok {
-					clauses = removeCondition(clauses, cs)
-				}
-			}
-		} else {
-			for _, f := range fields {
-				if cs, ok := fs.ClauseSlice[f]; ok {
-					clauses = removeCondition(clauses, cs)
-				}
+	if len(fields) == 0 {
+		return fs.Clause
+	}
+
+	clauses := fs.Clause
+
+	excluded := make([]string, 0)
+
+	for k, _ := range fs.ClauseSlice {
+		in := false
+		for _, f := range fields {
+			if f == k {
+				in = true
+				break
 			}
 		}
 
-		if len(clauses) == 0 {
-			return ""
+		if !in {
+			excluded = append(excluded, k)
 		}
+	}
 
-		if token == "where" {
-			return fmt.Sprintf("WHERE %s", clauses)
+	if include {
+		for _, f := range excluded {
+			if cs, ok := fs.ClauseSlice[f]; ok {
+				clauses = removeCondition(clauses, cs)
+			}
 		}
-
-		if token == "having" {
-			return fmt.Sprintf("HAVING %s", clauses)
+	} else {
+		for _, f := range fields {
+			if cs, ok := fs.ClauseSlice[f]; ok {
+				clauses = removeCondition(clauses, cs)
+			}
 		}
 	}
 
-	return ""
+	return clauses
 }
 
 func processConditionsParameters(p string) (include bool, fields []string) {
@@ -158,6 +197,61 @@ func processConditionsParameters(p string) (include bool, fields []string) {
 	return true, strings.Split(p, ",")
 }
 
+// The sql keyword of condition token, scoped token such as where.inner use the keyword of where
+func conditionKeyword(token string) string {
+	switch strings.SplitN(token, ".", 2)[0] {
+	case "where":
+		return "WHERE"
+	case "having":
+		return "HAVING"
+	}
+
+	return ""
+}
+
+//
+//ConditionToken
+//
+// ConditionToken bind a condition statement with the keyword it rendered with, it is used for
+// the where, having and scoped tokens such as %where.inner
+type ConditionToken struct {
+	Keyword string
+	Stmt    ConditionStmt
+	// Security conditions are always rendered, the include and exclude params do not apply to them
+	Security ConditionStmt
+	rendered *bool
+}
+
+// Implement token replacer
+func (ct ConditionToken) TokenReplace(ctx map[string]interface{}) string {
+	return ct.render(ct.Stmt.Clause)
+}
+
+// Implement parameterized token replacer
+func (ct ConditionToken) TokenReplaceWithParams(params string, token string) string {
+	return ct.render(ct.Stmt.paramsClause(params))
+}
+
+func (ct ConditionToken) render(clause string) string {
+	if ct.rendered != nil {
+		*ct.rendered = true
+	}
+
+	if !ct.Security.IsEmpty() {
+		if clause == "" {
+			clause = ct.Security.Clause
+		} else {
+			clause = fmt.Sprintf("(%s) AND (%s)", clause, ct.Security.Clause)
+		}
+	}
+
+	if clause == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("%s %s", ct.Keyword, clause)
+}
+
 //
 //SqlLimit
 //
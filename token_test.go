@@ -169,6 +169,17 @@ func Test_tokenReplace(t *testing.T) {
 				},
 			},
 			wantRs: "SELECT name, age, sex, count(id) as lang FROM tb WHERE height >= :height_1 AND height <= :height_2 HAVING lang >= :lang_1 AND lang <= :lang_2 AND name IN(:name)",
+		}, {
+			name: "test scoped condition token",
+			args: args{
+				s: "SELECT * FROM (SELECT * FROM tb %where.inner{!lang}) t %where.outer %having.outer",
+				ctx: map[string]interface{}{
+					"where.inner":  ConditionToken{Keyword: "WHERE", Stmt: w2},
+					"where.outer":  ConditionToken{Keyword: "WHERE", Stmt: w1},
+					"having.outer": ConditionToken{Keyword: "HAVING", Stmt: w3},
+				},
+			},
+			wantRs: "SELECT * FROM (SELECT * FROM tb WHERE height >= :height_1 AND height <= :height_2) t WHERE cust_name LIKE :cust_name",
 		},
 	}
 	for _, tt := range tests {